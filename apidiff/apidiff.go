@@ -2,10 +2,6 @@
 // TODO: test exported alias refers to something in another package -- does correspondence work then?
 // TODO: CODE COVERAGE
 // TODO: note that we may miss correspondences because we bail early when we compare a signature (e.g. when lengths differ; we could do up to the shorter)
-// TODO: if you add an unexported method to an exposed interface, you have to check that
-//		every exposed type that previously implemented the interface still does. Otherwise
-//		an external assignment of the exposed type to the interface type could fail.
-// TODO: check constant values: large values aren't representable by some types.
 // TODO: Document all the incompatibilities we don't check for.
 
 package apidiff
@@ -15,6 +11,8 @@ import (
 	"go/constant"
 	"go/token"
 	"go/types"
+	"sort"
+	"strings"
 )
 
 // Changes reports on the differences between the APIs of the old and new packages.
@@ -22,20 +20,22 @@ import (
 // a detailed discussion of what constitutes an incompatible change, see the package
 // documentation.
 func Changes(old, new *types.Package) Report {
-	d := newDiffer(old, new)
-	d.checkPackage()
-	r := Report{}
-	for _, m := range d.incompatibles.collect() {
-		r.Changes = append(r.Changes, Change{Message: m, Compatible: false})
-	}
-	for _, m := range d.compatibles.collect() {
-		r.Changes = append(r.Changes, Change{Message: m, Compatible: true})
-	}
-	return r
+	return (&Config{}).Changes(old, new)
 }
 
 type differ struct {
+	conf *Config
+	// The old and new packages currently being compared.
 	old, new *types.Package
+	// Paths of all the old and new packages relative to their module
+	// roots. Defined types and unexported names from packages with the same
+	// relative path are treated as the same across versions.
+	oldRel, newRel map[*types.Package]string
+	// The old and new packages, indexed by relative path.
+	oldPkgs, newPkgs map[string]*types.Package
+	// Import paths under which changes to objects of each old and new package
+	// are reported.
+	reportPaths map[*types.Package]string
 	// Correspondences between named types.
 	// Even though it is the named types (*types.Named) that correspond, we use
 	// *types.TypeName as a map key because they are canonical.
@@ -47,26 +47,63 @@ type differ struct {
 	compatibles   messageSet
 }
 
-func newDiffer(old, new *types.Package) *differ {
+func newDiffer(conf *Config) *differ {
 	return &differ{
-		old:           old,
-		new:           new,
+		conf:          conf,
+		oldRel:        map[*types.Package]string{},
+		newRel:        map[*types.Package]string{},
+		reportPaths:   map[*types.Package]string{},
 		correspondMap: map[*types.TypeName]types.Type{},
 		incompatibles: messageSet{},
 		compatibles:   messageSet{},
 	}
 }
 
-func (d *differ) incompatible(obj types.Object, part, format string, args ...interface{}) {
-	addMessage(d.incompatibles, obj, part, format, args)
+// reportPath returns the import path under which changes to obj are reported.
+func (d *differ) reportPath(obj types.Object) string {
+	if p, ok := d.reportPaths[obj.Pkg()]; ok {
+		return p
+	}
+	if obj.Pkg() != nil {
+		return obj.Pkg().Path()
+	}
+	return ""
 }
 
-func (d *differ) compatible(obj types.Object, part, format string, args ...interface{}) {
-	addMessage(d.compatibles, obj, part, format, args)
+func (d *differ) incompatible(obj types.Object, part string, kind ChangeKind, format string, args ...interface{}) {
+	d.add(false, obj, part, message{kind: kind, text: fmt.Sprintf(format, args...)})
 }
 
-func addMessage(ms messageSet, obj types.Object, part, format string, args []interface{}) {
-	ms.add(obj, part, fmt.Sprintf(format, args...))
+func (d *differ) compatible(obj types.Object, part string, kind ChangeKind, format string, args ...interface{}) {
+	d.add(true, obj, part, message{kind: kind, text: fmt.Sprintf(format, args...)})
+}
+
+// add records msg for obj and part as a compatible or incompatible change,
+// subject to the configured severity of msg's kind.
+func (d *differ) add(compatible bool, obj types.Object, part string, msg message) {
+	compatible, ok := d.conf.classify(msg.kind, compatible)
+	if ok {
+		msg.oldPos, msg.newPos = d.positions(obj)
+	}
+	switch {
+	case !ok:
+		return
+	case compatible:
+		d.compatibles.add(obj, part, msg)
+	default:
+		d.incompatibles.add(obj, part, msg)
+	}
+}
+
+// changedMessage returns a message of the given kind describing a change from
+// old to new.
+func changedMessage(kind ChangeKind, old, new string) message {
+	return message{
+		kind: kind,
+		text: fmt.Sprintf("changed from %s to %s", old, new),
+		old:  old,
+		new:  new,
+	}
 }
 
 func (d *differ) checkPackage() {
@@ -78,7 +115,7 @@ func (d *differ) checkPackage() {
 		}
 		newobj := d.new.Scope().Lookup(name)
 		if newobj == nil {
-			d.incompatible(oldobj, "", "removed")
+			d.incompatible(oldobj, "", Removed, "removed")
 			continue
 		}
 		d.checkObjects(oldobj, newobj)
@@ -87,15 +124,27 @@ func (d *differ) checkPackage() {
 	for _, name := range d.new.Scope().Names() {
 		newobj := d.new.Scope().Lookup(name)
 		if newobj.Exported() && d.old.Scope().Lookup(name) == nil {
-			d.compatible(newobj, "", "added")
+			d.compatible(newobj, "", Added, "added")
 		}
 	}
+}
 
+// checkImplementations checks that exposed types continue to implement
+// exposed interfaces. It must be called after all packages have been
+// checked, so that every correspondence has been established. When comparing
+// modules, that includes types and interfaces from different packages.
+//
+// A type can stop implementing an interface because it lost a method, or
+// because a method, possibly an unexported one, was added to the interface.
+func (d *differ) checkImplementations() {
+	// The interfaces that each old type no longer implements.
+	lost := map[*types.TypeName][]string{}
 	// Whole-package satisfaction.
 	// For every old exposed interface oIface and its corresponding new interface nIface...
 	for otn1, nt1 := range d.correspondMap {
 		oIface, ok := otn1.Type().Underlying().(*types.Interface)
-		if !ok {
+		if !ok || !oIface.IsMethodSet() {
+			// Interfaces with type terms can only be used as constraints.
 			continue
 		}
 		nIface, ok := nt1.Underlying().(*types.Interface)
@@ -105,16 +154,35 @@ func (d *differ) checkPackage() {
 			continue
 		}
 		// For every old type that implements oIface, its corresponding new type must implement
-		// nIface.
+		// nIface. If only a pointer to the old type implements oIface, then a pointer
+		// to the new type must implement nIface.
 		for otn2, nt2 := range d.correspondMap {
 			if otn1 == otn2 {
 				continue
 			}
-			if types.Implements(otn2.Type(), oIface) && !types.Implements(nt2, nIface) {
-				d.incompatible(otn2, "", "no longer implements %s", objectString(otn1))
+			iname := objectString(otn1)
+			if otn1.Pkg() != otn2.Pkg() {
+				iname = otn1.Pkg().Path() + "." + iname
+			}
+			ot2 := otn2.Type()
+			switch {
+			case types.Implements(ot2, oIface):
+				if !types.Implements(nt2, nIface) {
+					lost[otn2] = append(lost[otn2], iname)
+				}
+			case types.Implements(types.NewPointer(ot2), oIface):
+				if !types.Implements(types.NewPointer(nt2), nIface) {
+					lost[otn2] = append(lost[otn2], fmt.Sprintf("%s (as *%s)", iname, otn2.Name()))
+				}
 			}
 		}
 	}
+	// Report all the interfaces a type no longer implements in one message,
+	// since there can be only one message for the type.
+	for otn, ifaces := range lost {
+		sort.Strings(ifaces)
+		d.incompatible(otn, "", NoLongerImplements, "no longer implements %s", strings.Join(ifaces, ", "))
+	}
 }
 
 func (d *differ) checkObjects(old, new types.Object) {
@@ -132,10 +200,14 @@ func (d *differ) checkObjects(old, new types.Object) {
 	case *types.Func:
 		switch new := new.(type) {
 		case *types.Func:
-			d.checkCorrespondence(old, "", old.Type(), new.Type())
+			osig := old.Type().(*types.Signature)
+			nsig := new.Type().(*types.Signature)
+			if d.checkTypeParams(old, osig.TypeParams(), nsig.TypeParams()) {
+				d.checkCorrespondence(old, "", osig, nsig)
+			}
 			return
 		case *types.Var:
-			d.compatible(old, "", "changed from func to var")
+			d.add(true, old, "", changedMessage(ObjectKindChanged, "func", "var"))
 			d.checkCorrespondence(old, "", old.Type(), new.Type())
 			return
 
@@ -149,26 +221,52 @@ func (d *differ) checkObjects(old, new types.Object) {
 		panic("unexpected obj type")
 	}
 	// Here if kind of type changed.
-	d.incompatible(old, "", "changed from %s to %s",
-		objectKindString(old), objectKindString(new))
+	d.add(false, old, "", changedMessage(ObjectKindChanged, objectKindString(old), objectKindString(new)))
 }
 
 // Compare two constants.
+//
+// A change between an untyped and a typed constant is distinguished from
+// other type changes, and a change of value that makes the constant
+// unrepresentable by a sized numeric type that could represent it before is
+// distinguished from other value changes.
 func (d *differ) constChanges(old, new *types.Const) {
 	ot := old.Type()
 	nt := new.Type()
 	// Check for change of type.
 	if !d.correspond(ot, nt) {
-		d.typeChanged(old, "", ot, nt)
+		msg := d.typeChangedMessage(ot, nt)
+		switch ou, nu := isUntyped(ot), isUntyped(nt); {
+		case ou && !nu:
+			msg.kind = BecameTyped
+		case !ou && nu:
+			msg.kind = BecameUntyped
+		}
+		d.add(false, old, "", msg)
 		return
 	}
 	// Check for change of value.
 	// We know the types are the same, so constant.Compare shouldn't panic.
 	if !constant.Compare(old.Val(), token.EQL, new.Val()) {
-		d.incompatible(old, "", "value changed from %s to %s", old.Val(), new.Val())
+		msg := message{
+			kind: ValueChanged,
+			text: fmt.Sprintf("value changed from %s to %s", old.Val(), new.Val()),
+			old:  old.Val().String(),
+			new:  new.Val().String(),
+		}
+		if lost := lostRepresentations(old.Val(), new.Val()); len(lost) > 0 {
+			msg.kind = ValueNotRepresentable
+			msg.text += "; no longer representable by " + strings.Join(lost, ", ")
+		}
+		d.add(false, old, "", msg)
 	}
 }
 
+func isUntyped(t types.Type) bool {
+	b, ok := t.(*types.Basic)
+	return ok && b.Info()&types.IsUntyped != 0
+}
+
 func objectKindString(obj types.Object) string {
 	switch obj.(type) {
 	case *types.Const:
@@ -191,11 +289,23 @@ func (d *differ) checkCorrespondence(obj types.Object, part string, old, new typ
 }
 
 func (d *differ) typeChanged(obj types.Object, part string, old, new types.Type) {
-	old = removeNamesFromSignature(old)
-	new = removeNamesFromSignature(new)
-	olds := types.TypeString(old, types.RelativeTo(d.old))
-	news := types.TypeString(new, types.RelativeTo(d.new))
-	d.incompatible(obj, part, "changed from %s to %s", olds, news)
+	d.add(false, obj, part, d.typeChangedMessage(old, new))
+}
+
+func (d *differ) typeChangedMessage(old, new types.Type) message {
+	return changedMessage(TypeChanged, typeString(old, d.old), typeString(new, d.new))
+}
+
+// typeString formats t relative to pkg, omitting parameter names from
+// signatures.
+func typeString(t types.Type, pkg *types.Package) string {
+	t = types.Unalias(t)
+	s := types.TypeString(removeNamesFromSignature(t), types.RelativeTo(pkg))
+	if sig, ok := t.(*types.Signature); ok && sig.TypeParams().Len() > 0 {
+		// removeNamesFromSignature drops the type parameters.
+		s = "func" + typeParamsString(sig.TypeParams(), pkg) + strings.TrimPrefix(s, "func")
+	}
+	return s
 }
 
 // go/types always includes the argument and result names when formatting a signature.
@@ -2,7 +2,11 @@ package apidiff
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"go/types"
 	"io/ioutil"
 	"os"
@@ -13,6 +17,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/tools/go/packages"
 )
@@ -47,8 +52,863 @@ func TestChanges(t *testing.T) {
 	if !reflect.DeepEqual(got, wantc) {
 		t.Errorf("compatibles: got %v\nwant %v\n", got, wantc)
 	}
+	for _, c := range report.Changes {
+		if c.Package == "" || c.Object == "" || c.Kind == "" {
+			t.Errorf("%s: missing structured information: %+v", c.Message, c)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	want := Report{Changes: []Change{
+		{
+			Message:    "F: changed from func(int) to func(int) bool",
+			Compatible: false,
+			Package:    "example.com/p",
+			Object:     "F",
+			Kind:       TypeChanged,
+			Old:        "func(int)",
+			New:        "func(int) bool",
+		},
+		{
+			Message:    "S.X: added",
+			Compatible: true,
+			Package:    "example.com/p",
+			Object:     "S",
+			Part:       "X",
+			Kind:       Added,
+			NewPos:     token.Position{Filename: "p.go", Offset: 20, Line: 3, Column: 2},
+		},
+	}}
+	var buf bytes.Buffer
+	if err := want.JSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "Pos"); n != 1 {
+		t.Errorf("got %d positions in JSON, want only NewPos of S.X:\n%s", n, buf.String())
+	}
+	got, err := ReadJSON(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestModuleChanges(t *testing.T) {
+	oldm := checkModule(t, "example.com/m", map[string]string{
+		"a": `package a; type T struct{ X int }; func F() T { return T{} }`,
+		"b": `package b; var V int`,
+		"c": `package c; const C = 1`,
+	})
+	newm := checkModule(t, "example.com/m/v2", map[string]string{
+		"a": `package a; import "example.com/m/v2/b"; type T = b.T; func F() T { return T{} }`,
+		"b": `package b; var V int; type T struct{ X, Y int }`,
+		"d": `package d; const D = 1`,
+	})
+	report := ModuleChanges(oldm, newm)
+
+	var got []string
+	for _, c := range report.Changes {
+		got = append(got, fmt.Sprintf("%t %s: %s", c.Compatible, c.Package, c.Message))
+	}
+	want := []string{
+		"false example.com/m/c: package removed",
+		"true example.com/m/v2/a: T.Y: added",
+		"true example.com/m/v2/b: T: added",
+		"true example.com/m/v2/d: package added",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
 }
 
+func TestModuleImplementations(t *testing.T) {
+	// A type in one package stops implementing an interface in another.
+	oldm := checkModule(t, "example.com/m", map[string]string{
+		"a": `package a; type I interface{ M() }`,
+		"b": `package b; type T int; func (T) M() {}`,
+	})
+	newm := checkModule(t, "example.com/m", map[string]string{
+		"a": `package a; type I interface{ M(); N() }`,
+		"b": `package b; type T int; func (T) M() {}`,
+	})
+	var got []string
+	for _, c := range ModuleChanges(oldm, newm).Changes {
+		if !c.Compatible {
+			got = append(got, c.Package+": "+c.Message)
+		}
+	}
+	want := []string{
+		"example.com/m/a: I.N: added",
+		"example.com/m/b: T: no longer implements example.com/m/a.I",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestConfigSeverity(t *testing.T) {
+	oldm := checkModule(t, "example.com/m", map[string]string{
+		"p": `package p; const (Version = 1; Flag = 255; Typed = 3)`,
+	})
+	newm := checkModule(t, "example.com/m", map[string]string{
+		"p": `package p; const (Version = 2; Flag = 256; Typed int = 3)`,
+	})
+	for _, test := range []struct {
+		severity map[ChangeKind]Severity
+		want     []string
+	}{
+		{
+			nil,
+			[]string{
+				"false became-typed Typed: changed from untyped int to int",
+				"false value-changed Version: value changed from 1 to 2",
+				"false value-not-representable Flag: value changed from 255 to 256; no longer representable by uint8",
+			},
+		},
+		{
+			map[ChangeKind]Severity{ValueChanged: Compatible, BecameTyped: Ignore},
+			[]string{
+				"false value-not-representable Flag: value changed from 255 to 256; no longer representable by uint8",
+				"true value-changed Version: value changed from 1 to 2",
+			},
+		},
+	} {
+		conf := &Config{Severity: test.severity}
+		var got []string
+		for _, c := range conf.ModuleChanges(oldm, newm).Changes {
+			got = append(got, fmt.Sprintf("%t %s %s", c.Compatible, c.Kind, c.Message))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got\n%s\nwant\n%s", test.severity, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestSuppress(t *testing.T) {
+	sups, err := ParseSuppressions("sups.txt", []byte(`
+# Acknowledged breaks.
+example.com/p.F type-changed expires=2020-12-31 F was experimental
+"example.com/p.C.element type" type-changed
+example.com/p.G removed
+example.com/p.H removed expires=2020-01-01
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Report{Changes: []Change{
+		{Message: "C, element type: changed from int to bool", Package: "example.com/p", Object: "C", Part: "element type", Kind: TypeChanged},
+		{Message: "F: changed from func() to func(int)", Package: "example.com/p", Object: "F", Kind: TypeChanged},
+		{Message: "F2: removed", Package: "example.com/p", Object: "F2", Kind: Removed},
+		{Message: "H: removed", Package: "example.com/p", Object: "H", Kind: Removed},
+	}}
+	r = r.Suppress(sups, time.Date(2020, 12, 31, 12, 0, 0, 0, time.UTC))
+
+	var buf bytes.Buffer
+	if err := r.Text(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `Incompatible changes:
+- F2: removed
+- H: removed
+Suppressed changes:
+- example.com/p.C.element type: changed from int to bool
+- example.com/p.F: changed from func() to func(int) (F was experimental)
+Stale suppressions:
+- sups.txt:5: example.com/p.G removed: unused
+- sups.txt:6: example.com/p.H removed: expired
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	r := Report{
+		Changes: []Change{
+			{Message: "T.X: removed", Package: "example.com/m/p", Object: "T", Part: "X", Kind: Removed},
+			{Message: "F: changed from func() to func(*T)", Package: "example.com/m/p", Object: "F", Kind: TypeChanged},
+			{Message: "T: old is comparable, new is not", Package: "example.com/m/p", Object: "T", Kind: NoLongerComparable},
+			{Message: "package removed", Package: "example.com/m/q", Kind: Removed},
+			{Message: "G: added", Compatible: true, Package: "example.com/m/p", Object: "G", Kind: Added},
+		},
+		Suppressed: []SuppressedChange{{
+			Change:      Change{Message: "H: removed", Package: "example.com/m/p", Object: "H", Kind: Removed},
+			Suppression: Suppression{Path: "example.com/m/p.H", Kind: Removed, Justification: "was <experimental>"},
+		}},
+	}
+	link := func(c Change) string {
+		if c.Object == "T" && c.Part == "" {
+			return "https://example.com/p.go#L3"
+		}
+		return ""
+	}
+
+	var buf bytes.Buffer
+	if err := (&MarkdownRenderer{Title: "Release notes", Link: link}).Render(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Release notes\n" +
+		"\n" +
+		"## Incompatible changes\n" +
+		"\n" +
+		"### `example.com/m/p`\n" +
+		"\n" +
+		"- [`T`](https://example.com/p.go#L3)\n" +
+		"  - X: removed\n" +
+		"  - old is comparable, new is not\n" +
+		"- `F`: changed from func() to func(\\*T)\n" +
+		"\n" +
+		"### `example.com/m/q`\n" +
+		"\n" +
+		"- package removed\n" +
+		"\n" +
+		"## Compatible changes\n" +
+		"\n" +
+		"### `example.com/m/p`\n" +
+		"\n" +
+		"- `G`: added\n" +
+		"\n" +
+		"## Suppressed changes\n" +
+		"\n" +
+		"### `example.com/m/p`\n" +
+		"\n" +
+		"- `H`: removed _(was \\<experimental\\>)_\n" +
+		"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Markdown: got\n%s\nwant\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := (&HTMLRenderer{Link: link}).Render(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"<title>API changes</title>",
+		`<section class="incompatible">`,
+		`<section class="compatible">`,
+		`<section class="suppressed">`,
+		`<li><a href="https://example.com/p.go#L3"><code>T</code></a>`,
+		"<li><code>X</code>: removed</li>",
+		"<li><code>F</code>: changed from func() to func(*T)</li>",
+		"<li>package removed</li>",
+		`removed <span class="note">(was &lt;experimental&gt;)</span>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("HTML output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRenderPositions(t *testing.T) {
+	r := Report{Changes: []Change{
+		{Message: "F: changed from func() to func(int)", Package: "example.com/m/p", Object: "F", Kind: TypeChanged,
+			OldPos: token.Position{Filename: "p/p.go", Line: 3}, NewPos: token.Position{Filename: "p/p.go", Line: 7}},
+		{Message: "G: removed", Package: "example.com/m/p", Object: "G", Kind: Removed,
+			OldPos: token.Position{Filename: "/src/p/p.go", Line: 5}},
+	}}
+
+	var buf bytes.Buffer
+	if err := (&MarkdownRenderer{}).Render(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"- [`F`](p/p.go#L7) (`p/p.go:7`): changed from func() to func(int)\n",
+		"- [`G`](file:///src/p/p.go#L5) (`/src/p/p.go:5`): removed\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Markdown output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := (&HTMLRenderer{}).Render(&buf, r); err != nil {
+		t.Fatal(err)
+	}
+	want := `<li><a href="p/p.go#L7"><code>F</code></a> <span class="pos">(<code>p/p.go:7</code>)</span>: changed from func() to func(int)</li>`
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("HTML output does not contain %q:\n%s", want, buf.String())
+	}
+}
+
+func TestPositions(t *testing.T) {
+	fset := token.NewFileSet()
+	old := checkPackages(t, fset, map[string]string{"example.com/p": `package p
+
+func F() {}
+
+func G() {}
+
+type T struct{}
+
+func (T) M() {}
+`})["example.com/p"]
+	new := checkPackages(t, fset, map[string]string{"example.com/p": `package p
+
+type T struct{}
+
+func (T) M(int) {}
+
+func F(int) {}
+
+func H() {}
+`})["example.com/p"]
+	conf := &Config{OldFset: fset, NewFset: fset}
+	r := conf.Changes(old, new)
+
+	var buf bytes.Buffer
+	if err := r.Text(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `Incompatible changes:
+- example.com/p.go:7: F: changed from func() to func(int)
+- example.com/p.go:5: G: removed
+- example.com/p.go:5: T.M: changed from func() to func(int)
+Compatible changes:
+- example.com/p.go:9: H: added
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	for _, c := range r.Changes {
+		if c.Object == "F" {
+			if got := fmt.Sprintf("%s:%d", c.OldPos.Filename, c.OldPos.Line); got != "example.com/p.go:3" {
+				t.Errorf("F: OldPos = %s, want example.com/p.go:3", got)
+			}
+		}
+	}
+
+	// Without file sets, there are no positions.
+	for _, c := range Changes(old, new).Changes {
+		if c.OldPos.IsValid() || c.NewPos.IsValid() {
+			t.Errorf("%s: got positions %s and %s, want none", c.Message, c.OldPos, c.NewPos)
+		}
+	}
+}
+
+func TestStructChecks(t *testing.T) {
+	fset := token.NewFileSet()
+	old := checkPackages(t, fset, map[string]string{"example.com/p": `package p
+
+type T struct {
+	A int    ` + "`json:\"a\" db:\"a\"`" + `
+	B string ` + "`json:\"b,omitempty\"`" + `
+	C bool
+	E
+}
+
+type U struct {
+	X, Y int
+	z    int
+}
+
+type E struct{}
+
+func (E) M() {}
+func (E) N() {}
+`})["example.com/p"]
+	new := checkPackages(t, fset, map[string]string{"example.com/p": `package p
+
+type T struct {
+	B string ` + "`json:\"b\"`" + `
+	A int    ` + "`json:\"a\"`" + `
+	C bool   ` + "`db:\"c\"`" + `
+	E
+}
+
+func (T) M() {}
+
+type U struct {
+	Y, X int
+	z    int
+}
+
+type E struct{}
+
+func (E) M() {}
+func (E) N() {}
+`})["example.com/p"]
+	conf := &Config{TagKeys: []string{"json", "db"}, FieldOrder: true, Promotion: true}
+	got := map[string]Change{}
+	for _, c := range conf.Changes(old, new).Changes {
+		got[c.Message] = c
+	}
+	for _, want := range []Change{
+		{Message: `T.A, db tag: removed "a"`, Object: "T", Part: "A, db tag", Kind: TagRemoved, Old: "a"},
+		{Message: `T.B, json tag: changed from "b,omitempty" to "b"`, Object: "T", Part: "B, json tag", Kind: TagChanged, Old: "b,omitempty", New: "b"},
+		{Message: `T.C, db tag: added "c"`, Object: "T", Part: "C, db tag", Kind: TagChanged, New: "c"},
+		{Message: "T, field order: changed from A, B, C, E to B, A, C, E", Object: "T", Part: "field order", Kind: FieldsReordered, Old: "A, B, C, E", New: "B, A, C, E"},
+		{Message: "T, method M: changed from T.E.M to T.M", Compatible: true, Object: "T", Part: "method M", Kind: PromotionChanged, Old: "T.E.M", New: "T.M"},
+	} {
+		c, ok := got[want.Message]
+		if !ok {
+			t.Errorf("missing change %q", want.Message)
+			continue
+		}
+		want.Package = "example.com/p"
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("got  %+v\nwant %+v", c, want)
+		}
+		delete(got, want.Message)
+	}
+	// U has an unexported field, so its fields cannot be reordered in
+	// unkeyed literals outside the package.
+	for msg := range got {
+		t.Errorf("unexpected change %q", msg)
+	}
+
+	// The checks are disabled by default.
+	for _, c := range Changes(old, new).Changes {
+		switch c.Kind {
+		case TagChanged, TagRemoved, FieldsReordered, PromotionChanged:
+			t.Errorf("unexpected change %q with the zero Config", c.Message)
+		}
+	}
+}
+
+func TestHints(t *testing.T) {
+	fset := token.NewFileSet()
+	parse := func(filename, src string) *PackageSyntax {
+		f, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &PackageSyntax{Path: "example.com/p", Fset: fset, Files: []*ast.File{f}}
+	}
+	old := parse("old.go", `package p
+
+// F does something.
+//
+// Deprecated: use G.
+func F(x int) {
+	if x < 0 {
+		panic("negative")
+	}
+}
+
+func (*T) M() {}
+
+type T struct{}
+
+var V = []int{1, 2}
+
+var W = map[string]int{
+	"a": 1,
+}
+
+func g() { panic("unexported") }
+`)
+	new := parse("new.go", `package p
+
+// F does something.
+func F(x int) {
+	if x < 0 {
+		panic("negative")
+	}
+	if x > 10 {
+		panic(fmt.Sprintf("too big: %d", x))
+	}
+}
+
+func (*T) M() { panic("unimplemented") }
+
+type T struct{}
+
+var V = []int{1, 2, 3}
+
+var W = map[string]int{"a": 1}
+
+func g() { panic("unexported too") }
+`)
+	got := Hints(old, new)
+	want := []Hint{
+		{
+			Message: "(*T).M: may now panic: panic(\"unimplemented\")",
+			Package: "example.com/p",
+			Object:  "(*T).M",
+			Kind:    NewPanic,
+		},
+		{
+			Message: "F: deprecation notice removed",
+			Package: "example.com/p",
+			Object:  "F",
+			Kind:    DeprecationRemoved,
+		},
+		{
+			Message: `F: may now panic: panic(fmt.Sprintf("too big: %d", x))`,
+			Package: "example.com/p",
+			Object:  "F",
+			Kind:    NewPanic,
+		},
+		{
+			Message: "V: initializer changed",
+			Package: "example.com/p",
+			Object:  "V",
+			Kind:    InitializerChanged,
+		},
+	}
+	wantPos := []string{"new.go:13:17", "new.go:4:6", "new.go:9:3", "new.go:17:9"}
+	var gotPos []string
+	var gotHints []Hint
+	for _, h := range got {
+		gotPos = append(gotPos, h.Pos.String())
+		h.Pos = token.Position{}
+		gotHints = append(gotHints, h)
+	}
+	if !reflect.DeepEqual(gotHints, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", gotHints, want)
+	}
+	if !reflect.DeepEqual(gotPos, wantPos) {
+		t.Errorf("got positions %v, want %v", gotPos, wantPos)
+	}
+
+	r := Report{Hints: got[1:2]}
+	var buf bytes.Buffer
+	if err := r.Text(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "Hints:\n- new.go:4: F: deprecation notice removed\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIsDeprecated(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "p.go", `package p
+
+// Deprecated: use G.
+func A() {}
+
+// B does something.
+//
+// Deprecated: use G.
+func B() {}
+
+/*
+C does something.
+	
+Deprecated: use G.
+*/
+func C() {}
+
+// D does something. Deprecated: use G.
+func D() {}
+
+// E does something.
+// Deprecated: use G.
+func E() {}
+
+func F() {}
+`, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, decl := range f.Decls {
+		if fd := decl.(*ast.FuncDecl); IsDeprecated(fd.Doc) {
+			got = append(got, fd.Name.Name)
+		}
+	}
+	if want := []string{"A", "B", "C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got deprecated %v, want %v", got, want)
+	}
+}
+
+func TestReceiverName(t *testing.T) {
+	for _, test := range []struct {
+		expr    string
+		name    string
+		pointer bool
+	}{
+		{"T", "T", false},
+		{"*T", "T", true},
+		{"(*T)", "T", true},
+		{"T[P]", "T", false},
+		{"*T[P, Q]", "T", true},
+		{"[]T", "", false},
+	} {
+		expr, err := parser.ParseExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name, pointer := ReceiverName(expr)
+		if name != test.name || pointer != test.pointer {
+			t.Errorf("ReceiverName(%s) = %q, %t, want %q, %t", test.expr, name, pointer, test.name, test.pointer)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ext := `package ext
+
+type Reader interface{ Read([]byte) (int, error) }
+
+type Buffer struct {
+	data []byte
+	Len  int
+}
+
+func (*Buffer) Write(p []byte) (int, error) { return len(p), nil }
+func (*Buffer) reset()                      {}
+
+type Opaque struct{ f func() }
+
+type Unused int
+`
+	q := `package q
+
+type Num int
+
+type T struct{ Z Num }
+`
+	oldP := `package p
+
+import (
+	"example.com/ext"
+	"example.com/m/q"
+)
+
+const (
+	C       = 1.5
+	R       = 'x'
+	Z       = 1 + 2i
+	N q.Num = 3
+	S       = "s"
+)
+
+var V q.T
+
+type T struct {
+	ext.Buffer
+	X int ` + "`json:\"x\"`" + `
+	o ext.Opaque
+	h hidden
+}
+
+type hidden struct{ Y int }
+
+func (T) M(r ext.Reader) {}
+func (*T) m()            {}
+
+type G[K comparable, V any] struct{ M map[K]V }
+
+func (G[K, V]) Get(k K) V { var v V; return v }
+
+func F[T ~int | ~string](x T) T { return x }
+
+type A = q.T
+`
+	newP := strings.Replace(oldP, "func (T) M(r ext.Reader) {}", "func (T) M(r ext.Reader, n int) {}", 1)
+	newP = strings.Replace(newP, "C       = 1.5", "C       = 2.5", 1)
+
+	check := func(p string) (*Module, *token.FileSet) {
+		fset := token.NewFileSet()
+		srcs := map[string]string{"example.com/ext": ext, "example.com/m/q": q, "example.com/m/p": p}
+		pkgs := checkPackages(t, fset, srcs)
+		return &Module{Path: "example.com/m", Packages: []*types.Package{pkgs["example.com/m/p"], pkgs["example.com/m/q"]}}, fset
+	}
+	oldm, _ := check(oldP)
+	newm, _ := check(newP)
+
+	var buf bytes.Buffer
+	if err := WriteSnapshot(&buf, oldm); err != nil {
+		t.Fatal(err)
+	}
+	want := `// apidiff API snapshot v1
+// module example.com/m
+
+package p // import "example.com/m/p"
+
+import (
+	ext "example.com/ext"
+	q "example.com/m/q"
+)
+
+const C = 1.5
+
+const N q.Num = 3
+
+const R = 'x'
+
+const S = "s"
+
+const Z = complex(1.0, 2.0)
+
+var V q.T
+
+type A = q.T
+
+type G[K comparable, V any] struct {
+	M map[K]V
+}
+
+func (G[K, V]) Get(k K) V
+
+type T struct {
+	ext.Buffer
+	X int ` + "`json:\"x\"`" + `
+	o ext.Opaque
+	h hidden
+}
+
+func (T) M(r ext.Reader)
+
+func (*T) m()
+
+type hidden struct {
+	Y int
+}
+
+func F[T ~int | ~string](x T) T
+
+package q // import "example.com/m/q"
+
+type Num int
+
+type T struct {
+	Z Num
+}
+
+package ext // import "example.com/ext" external
+
+type Buffer struct {
+	Len int
+	_   [0]func()
+}
+
+func (*Buffer) Write(p []byte) (int, error)
+
+type Opaque struct {
+	_ [0]func()
+}
+
+type Reader interface {
+	Read([]byte) (int, error)
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	fset := token.NewFileSet()
+	snap, err := ParseSnapshot(fset, "api.txt", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := ModuleChanges(oldm, snap); len(r.Changes) > 0 {
+		t.Errorf("snapshot differs from its source:\n%s", r)
+	}
+	// Comparing the snapshot with a new version reports the same changes as
+	// comparing the original packages.
+	if got, want := ModuleChanges(snap, newm).String(), ModuleChanges(oldm, newm).String(); got != want || want == "" {
+		t.Errorf("from snapshot:\n%s\nfrom source:\n%s", got, want)
+	}
+	// Positions refer to the snapshot.
+	conf := &Config{OldFset: fset}
+	for _, c := range conf.ModuleChanges(snap, newm).Changes {
+		if c.Object == "C" && c.OldPos.String() != "api.txt:11:7" {
+			t.Errorf("C: got position %s, want api.txt:11:7", c.OldPos)
+		}
+	}
+
+	if _, err := ParseSnapshot(fset, "api.txt", []byte("// apidiff API snapshot v99\n")); err == nil || !strings.Contains(err.Error(), "unsupported snapshot version") {
+		t.Errorf("got error %v, want unsupported version", err)
+	}
+}
+
+func TestMergePlatforms(t *testing.T) {
+	// The old version declares Mmap on both platforms, and Fd only on
+	// Linux. The new version removes Mmap on Windows, and Fd.
+	unix := ModuleChanges(
+		checkModule(t, "example.com/m", map[string]string{"p": `package p; func Mmap() {}; func Fd() int { return 0 }; func F() {}`}),
+		checkModule(t, "example.com/m", map[string]string{"p": `package p; func Mmap() {}; func G() {}`}))
+	windows := ModuleChanges(
+		checkModule(t, "example.com/m", map[string]string{"p": `package p; func Mmap() {}; func F() {}`}),
+		checkModule(t, "example.com/m", map[string]string{"p": `package p; func G() {}`}))
+	windows.Hints = []Hint{{Message: "G: may now panic: panic(1)", Package: "example.com/m/p", Object: "G", Kind: NewPanic}}
+
+	r := MergePlatforms([]PlatformReport{
+		{"linux/amd64", unix},
+		{"windows/amd64", windows},
+	})
+	var got []string
+	for _, c := range r.Changes {
+		got = append(got, fmt.Sprintf("%t %s %v", c.Compatible, c.Message, c.Platforms))
+	}
+	want := []string{
+		"false F: removed []",
+		"false Fd: removed (only on linux/amd64) [linux/amd64]",
+		"false Mmap: removed (only on windows/amd64) [windows/amd64]",
+		"true G: added []",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(r.Hints) != 1 || r.Hints[0].Message != "G: may now panic: panic(1) (only on windows/amd64)" {
+		t.Errorf("got hints %v", r.Hints)
+	}
+}
+
+// checkPackages type-checks packages from source. Each key of srcs is an
+// import path, and each value is the source of a single file in that
+// package, named after the import path with a ".go" suffix. Packages may
+// import each other, but nothing else.
+func checkPackages(t *testing.T, fset *token.FileSet, srcs map[string]string) map[string]*types.Package {
+	t.Helper()
+	pkgs := map[string]*types.Package{}
+	var check func(path string) (*types.Package, error)
+	check = func(path string) (*types.Package, error) {
+		if pkg := pkgs[path]; pkg != nil {
+			return pkg, nil
+		}
+		src, ok := srcs[path]
+		if !ok {
+			return nil, fmt.Errorf("no package %s", path)
+		}
+		f, err := parser.ParseFile(fset, path+".go", src, 0)
+		if err != nil {
+			return nil, err
+		}
+		conf := types.Config{Importer: importerFunc(check)}
+		pkg, err := conf.Check(path, fset, []*ast.File{f}, nil)
+		if err != nil {
+			return nil, err
+		}
+		pkgs[path] = pkg
+		return pkg, nil
+	}
+	for path := range srcs {
+		if _, err := check(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pkgs
+}
+
+// checkModule type-checks a module from source with checkPackages. Each key
+// of srcs is a package path relative to modPath, and each value is the source
+// of a single file in that package.
+func checkModule(t *testing.T, modPath string, srcs map[string]string) *Module {
+	t.Helper()
+	pkgSrcs := map[string]string{}
+	for rel, src := range srcs {
+		pkgSrcs[modPath+"/"+rel] = src
+	}
+	m := &Module{Path: modPath}
+	for _, pkg := range checkPackages(t, token.NewFileSet(), pkgSrcs) {
+		m.Packages = append(m.Packages, pkg)
+	}
+	sort.Slice(m.Packages, func(i, j int) bool { return m.Packages[i].Path() < m.Packages[j].Path() })
+	return m
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
+
 func splitIntoPackages(t *testing.T, dir string) (incompatibles, compatibles []string) {
 	// Read the input file line by line.
 	// Write a line into the old or new package,
@@ -63,7 +923,7 @@ func splitIntoPackages(t *testing.T, dir string) (incompatibles, compatibles []s
 	if err := os.MkdirAll(filepath.Join(dir, "src", "apidiff"), 0700); err != nil {
 		t.Fatal(err)
 	}
-	if err := ioutil.WriteFile(filepath.Join(dir, "src", "apidiff", "go.mod"), []byte("module apidiff\n"), 0666); err != nil {
+	if err := ioutil.WriteFile(filepath.Join(dir, "src", "apidiff", "go.mod"), []byte("module apidiff\n\ngo 1.18\n"), 0666); err != nil {
 		t.Fatal(err)
 	}
 
@@ -48,9 +48,9 @@ func (d *differ) checkCompatibleChan(otn *types.TypeName, old, new *types.Chan)
 	d.checkCorrespondence(otn, ", element type", old.Elem(), new.Elem())
 	if old.Dir() != new.Dir() {
 		if new.Dir() == types.SendRecv {
-			d.compatible(otn, "", "removed direction")
+			d.compatible(otn, "", DirectionRemoved, "removed direction")
 		} else {
-			d.incompatible(otn, "", "changed direction")
+			d.incompatible(otn, "", DirectionChanged, "changed direction")
 		}
 	}
 }
@@ -63,7 +63,7 @@ func (d *differ) checkCompatibleBasic(otn *types.TypeName, old, new *types.Basic
 		return
 	}
 	if compatibleBasics[[2]types.BasicKind{old.Kind(), new.Kind()}] {
-		d.compatible(otn, "", "changed from %s to %s", old, new)
+		d.add(true, otn, "", changedMessage(TypeChanged, old.String(), new.String()))
 	} else {
 		d.typeChanged(otn, "", old, new)
 	}
@@ -105,12 +105,17 @@ var compatibleBasics = map[[2]types.BasicKind]bool{
 // unexported methods. (Adding an unexported method makes the interface
 // unimplementable outside the package.)
 //
-// TODO: must also check that if any methods were added or removed, every exposed
-// type in the package that implemented the interface in old still implements it in
-// new. Otherwise external assignments could fail.
+// If any methods were added or removed, every exposed type that implemented the
+// interface in old must still implement it in new, or external assignments could
+// fail. That is checked for the whole package (or module) in checkImplementations.
 func (d *differ) checkCompatibleInterface(otn *types.TypeName, old, new *types.Interface) {
 	// Method sets are checked in checkCompatibleDefined.
 
+	// The type terms of a constraint interface must correspond. See typeparams.go.
+	if !d.corrTypeSets(old, new, nil) {
+		d.typeChanged(otn, "", old, new)
+	}
+
 	// Does the old interface have an unexported method?
 	if unexportedMethod(old) != nil {
 		d.checkMethodSet(otn, old, new, additionsCompatible)
@@ -118,7 +123,7 @@ func (d *differ) checkCompatibleInterface(otn *types.TypeName, old, new *types.I
 		// Perform an equivalence check, but with more information.
 		d.checkMethodSet(otn, old, new, additionsIncompatible)
 		if u := unexportedMethod(new); u != nil {
-			d.incompatible(otn, u.Name(), "added unexported method")
+			d.incompatible(otn, u.Name(), UnexportedMethodAdded, "added unexported method")
 		}
 	}
 }
@@ -146,14 +151,35 @@ func unexportedMethod(t *types.Interface) *types.Func {
 // package, so it doesn't have to be present, or have the same name, in the new
 // struct.
 //
-// Field tags are ignored: they have no compile-time implications.
+// Field tags and field order are ignored by default: they have no compile-time
+// implications for keyed literals. See structs.go for the optional checks.
 func (d *differ) checkCompatibleStruct(obj types.Object, old, new *types.Struct) {
 	d.checkCompatibleObjectSets(obj, exportedFields(old), exportedFields(new))
 	d.checkCompatibleObjectSets(obj, exportedSelectableFields(old), exportedSelectableFields(new))
+	if len(d.conf.TagKeys) > 0 {
+		d.checkStructTags(obj, old, new)
+	}
+	if d.conf.FieldOrder {
+		d.checkFieldOrder(obj, old, new)
+	}
 	// Removing comparability from a struct is an incompatible change.
-	if types.Comparable(old) && !types.Comparable(new) {
-		d.incompatible(obj, "", "old is comparable, new is not")
+	if structComparable(old) && !structComparable(new) {
+		d.incompatible(obj, "", NoLongerComparable, "old is comparable, new is not")
+	}
+}
+
+// structComparable reports whether values of s can be compared. A field whose
+// type is a type parameter is assumed comparable, since the comparability of
+// an instantiated struct then depends on its type arguments, and clients can
+// only compare instantiations whose arguments are comparable.
+func structComparable(s *types.Struct) bool {
+	for i := 0; i < s.NumFields(); i++ {
+		t := s.Field(i).Type()
+		if _, ok := t.(*types.TypeParam); !ok && !types.Comparable(t) {
+			return false
+		}
 	}
+	return true
 }
 
 // exportedFields collects all the immediate fields of the struct that are exported.
@@ -243,20 +269,27 @@ func (d *differ) checkCompatibleObjectSets(obj types.Object, old, new map[string
 	for name, oldo := range old {
 		newo := new[name]
 		if newo == nil {
-			d.incompatible(obj, name, "removed")
+			d.incompatible(obj, name, Removed, "removed")
 		} else {
 			d.checkCorrespondence(obj, name, oldo.Type(), newo.Type())
 		}
 	}
 	for name := range new {
 		if old[name] == nil {
-			d.compatible(obj, name, "added")
+			d.compatible(obj, name, Added, "added")
 		}
 	}
 }
 
 func (d *differ) checkCompatibleDefined(otn *types.TypeName, old *types.Named, new types.Type) {
 	// We've already checked that old and new correspond.
+	var newtps *types.TypeParamList
+	if newn, ok := new.(*types.Named); ok {
+		newtps = newn.TypeParams()
+	}
+	if !d.checkTypeParams(otn, old.TypeParams(), newtps) {
+		return
+	}
 	d.checkCompatible(otn, old.Underlying(), new.Underlying())
 	// If there are different kinds of types (e.g. struct and interface), don't bother checking
 	// the method sets.
@@ -271,6 +304,9 @@ func (d *differ) checkCompatibleDefined(otn *types.TypeName, old *types.Named, n
 	// A new method set is compatible with an old if the new exported methods are a superset of the old.
 	d.checkMethodSet(otn, old, new, additionsCompatible)
 	d.checkMethodSet(otn, types.NewPointer(old), types.NewPointer(new), additionsCompatible)
+	if _, ok := old.Underlying().(*types.Struct); ok && d.conf.Promotion {
+		d.checkPromotion(otn, old, new)
+	}
 }
 
 const (
@@ -300,7 +336,7 @@ func (d *differ) checkMethodSet(otn *types.TypeName, oldt, newt types.Type, addc
 			if receiverNamedType(oldMethod).Obj() != otn {
 				part = fmt.Sprintf(", method set of %s", msname)
 			}
-			d.incompatible(oldMethod, part, "removed")
+			d.incompatible(oldMethod, part, Removed, "removed")
 		} else {
 			obj := oldMethod
 			// If a value method is changed to a pointer method and has a signature
@@ -319,9 +355,9 @@ func (d *differ) checkMethodSet(otn *types.TypeName, oldt, newt types.Type, addc
 	for name, newMethod := range newMethodSet {
 		if oldMethodSet[name] == nil {
 			if addcompat {
-				d.compatible(newMethod, "", "added")
+				d.compatible(newMethod, "", Added, "added")
 			} else {
-				d.incompatible(newMethod, "", "added")
+				d.incompatible(newMethod, "", Added, "added")
 			}
 		}
 	}
@@ -345,9 +381,9 @@ func receiverType(method types.Object) types.Type {
 }
 
 func receiverNamedType(method types.Object) *types.Named {
-	switch t := receiverType(method).(type) {
+	switch t := types.Unalias(receiverType(method)).(type) {
 	case *types.Pointer:
-		return t.Elem().(*types.Named)
+		return types.Unalias(t.Elem()).(*types.Named)
 	case *types.Named:
 		return t
 	default:
@@ -0,0 +1,71 @@
+package apidiff
+
+import (
+	"go/token"
+	"go/types"
+)
+
+// A Config controls how changes are classified and reported. The zero Config
+// classifies changes as described in the package documentation; its Changes
+// and ModuleChanges methods then behave like the functions of the same name.
+type Config struct {
+	// Severity overrides the classification of changes of the given kinds.
+	// For example, setting Severity[ValueChanged] to Compatible reports
+	// changes to constant values as compatible.
+	Severity map[ChangeKind]Severity
+
+	// OldFset and NewFset, if non-nil, are the file sets with which the old
+	// and new packages were loaded. They are used to record the source
+	// positions of changes in Change.OldPos and Change.NewPos.
+	OldFset, NewFset *token.FileSet
+
+	// TagKeys enables the comparison of struct tags. For each key, such as
+	// "json" or "db", a change to the value of that key in the tag of an
+	// exported field is reported as incompatible.
+	TagKeys []string
+	// FieldOrder enables reporting the reordering of fields of structs whose
+	// fields are all exported, since clients may write unkeyed literals of
+	// them. Reordering is reported as incompatible.
+	FieldOrder bool
+	// Promotion enables reporting methods of struct types that are promoted
+	// from a different embedded field, or are no longer or newly promoted,
+	// and so may behave differently. Such changes are reported as
+	// compatible.
+	Promotion bool
+}
+
+// A Severity determines how a change is reported.
+type Severity int
+
+const (
+	// DefaultSeverity reports a change with its usual classification.
+	DefaultSeverity Severity = iota
+	// Incompatible reports a change as incompatible.
+	Incompatible
+	// Compatible reports a change as compatible.
+	Compatible
+	// Ignore omits a change from the report.
+	Ignore
+)
+
+// Changes is like the Changes function, but classifies changes according to c.
+func (c *Config) Changes(old, new *types.Package) Report {
+	return c.ModuleChanges(
+		&Module{Path: old.Path(), Packages: []*types.Package{old}},
+		&Module{Path: new.Path(), Packages: []*types.Package{new}})
+}
+
+// classify returns the classification of a change of the given kind that
+// would otherwise have the given compatibility. The second result is false if
+// the change should be omitted.
+func (c *Config) classify(kind ChangeKind, compatible bool) (bool, bool) {
+	switch c.Severity[kind] {
+	case Incompatible:
+		return false, true
+	case Compatible:
+		return true, true
+	case Ignore:
+		return false, false
+	}
+	return compatible, true
+}
@@ -26,6 +26,8 @@ func (d *differ) correspond(old, new types.Type) bool {
 //
 // Compare this to the implementation of go/types.Identical.
 func (d *differ) corr(old, new types.Type, p *ifacePair) bool {
+	// Aliases are transparent: it is the types they denote that must correspond.
+	old, new = types.Unalias(old), types.Unalias(new)
 	// Structure copied from types.Identical.
 	switch old := old.(type) {
 	case *types.Basic:
@@ -58,9 +60,11 @@ func (d *differ) corr(old, new types.Type, p *ifacePair) bool {
 
 	case *types.Signature:
 		if new, ok := new.(*types.Signature); ok {
+			// Constraints of type parameters are compared by checkTypeParams.
 			pe := d.corr(old.Params(), new.Params(), p)
 			re := d.corr(old.Results(), new.Results(), p)
-			return old.Variadic() == new.Variadic() && pe && re
+			return old.Variadic() == new.Variadic() && pe && re &&
+				old.TypeParams().Len() == new.TypeParams().Len()
 		}
 
 	case *types.Tuple:
@@ -112,11 +116,17 @@ func (d *differ) corr(old, new types.Type, p *ifacePair) bool {
 					return false
 				}
 			}
-			return old.NumMethods() == new.NumMethods()
+			return old.NumMethods() == new.NumMethods() && d.corrTypeSets(old, new, q)
 		}
 
 	case *types.Named:
 		if new, ok := new.(*types.Named); ok {
+			if old.TypeArgs().Len() > 0 || new.TypeArgs().Len() > 0 {
+				// Instantiated types correspond if their generic types and
+				// their type arguments correspond.
+				ae := d.corrTypeArgs(old.TypeArgs(), new.TypeArgs(), p)
+				return d.establishCorrespondence(old.Origin(), new.Origin()) && ae
+			}
 			return d.establishCorrespondence(old, new)
 		}
 		if new, ok := new.(*types.Basic); ok {
@@ -125,6 +135,12 @@ func (d *differ) corr(old, new types.Type, p *ifacePair) bool {
 			return d.establishCorrespondence(old, new)
 		}
 
+	case *types.TypeParam:
+		// Type parameters of corresponding declarations correspond by position.
+		if new, ok := new.(*types.TypeParam); ok {
+			return old.Index() == new.Index()
+		}
+
 	default:
 		panic("unknown type kind")
 	}
@@ -138,8 +154,8 @@ func (d *differ) corr(old, new types.Type, p *ifacePair) bool {
 // we've established correspondence.
 func (d *differ) corrFieldNames(of, nf *types.Var) bool {
 	if of.Anonymous() && nf.Anonymous() && !of.Exported() && !nf.Exported() {
-		if on, ok := of.Type().(*types.Named); ok {
-			nn := nf.Type().(*types.Named)
+		if on, ok := types.Unalias(of.Type()).(*types.Named); ok {
+			nn := types.Unalias(nf.Type()).(*types.Named)
 			return d.establishCorrespondence(on, nn)
 		}
 	}
@@ -171,10 +187,13 @@ func (d *differ) establishCorrespondence(old *types.Named, new types.Type) bool
 		//
 		// What we should do is check that the old type, in the new world's package
 		// of the same path, doesn't correspond to something other than the new type.
-		// That is a bit hard, because there is no easy way to find a new package
-		// matching an old one.
+		// We can only do that for the packages being compared: when comparing
+		// whole modules, a type may correspond to one in a different package of
+		// the module, as when it has moved and left an alias behind.
 		if newn, ok := new.(*types.Named); ok {
-			if old.Obj().Pkg() != d.old || newn.Obj().Pkg() != d.new {
+			_, oldok := d.oldRel[old.Obj().Pkg()]
+			_, newok := d.newRel[newn.Obj().Pkg()]
+			if !oldok || !newok {
 				return old.Obj().Id() == newn.Obj().Id()
 			}
 		}
@@ -197,11 +216,12 @@ func (d *differ) sortedMethods(iface *types.Interface) []*types.Func {
 }
 
 func (d *differ) methodID(m *types.Func) string {
-	// If the method belongs to one of the two packages being compared, use
-	// just its name even if it's unexported. That lets us treat unexported names
-	// from the old and new packages as equal.
-	if m.Pkg() == d.old || m.Pkg() == d.new {
-		return m.Name()
+	// If the method belongs to one of the packages being compared, qualify it
+	// by the package's module-relative path even if it's unexported. That lets
+	// us treat unexported names from the old and new versions of a package as
+	// equal.
+	if rel, ok := d.relPath(m.Pkg()); ok && !m.Exported() {
+		return rel + "." + m.Name()
 	}
 	return m.Id()
 }
@@ -0,0 +1,377 @@
+package apidiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Hint is an advisory note about a change in behavior that the type-level
+// comparison of Changes cannot see, such as a function that may now panic.
+// Hints are heuristic and never affect compatibility.
+type Hint struct {
+	// Message is a human-readable description of the hint, prefixed by the
+	// name of the object, as in a Change.
+	Message string
+	// Package is the import path of the package that declares the object.
+	Package string
+	// Object is the name of the object, qualified by its receiver type for
+	// methods, as in "(*T).M".
+	Object string
+	Kind   HintKind
+	// Pos is the position in the new version of the code the hint is about.
+	// It is the zero Position if the syntax has no file set, and is then
+	// omitted from JSON.
+	Pos token.Position
+	// Platforms lists the platforms on which the hint applies, as for
+	// Change.Platforms.
+	Platforms []string `json:",omitempty"`
+}
+
+// MarshalJSON encodes h like encoding/json would by default, but omits the
+// zero position.
+func (h Hint) MarshalJSON() ([]byte, error) {
+	type hint Hint // without the MarshalJSON method
+	return json.Marshal(struct {
+		hint
+		Pos *token.Position `json:",omitempty"`
+	}{hint(h), jsonPosition(h.Pos)})
+}
+
+// A HintKind is a stable code that classifies a Hint.
+type HintKind string
+
+const (
+	// NewPanic means that the body of an exported function or method calls
+	// panic with arguments that it did not before.
+	NewPanic HintKind = "new-panic"
+	// InitializerChanged means that the initializer of an exported variable
+	// changed.
+	InitializerChanged HintKind = "initializer-changed"
+	// DeprecationRemoved means that the doc comment of an exported object no
+	// longer has a "Deprecated:" paragraph.
+	DeprecationRemoved HintKind = "deprecation-removed"
+)
+
+// PackageSyntax is the syntax of one version of a package, as needed by Hints.
+type PackageSyntax struct {
+	// Path is the import path under which hints are reported.
+	Path string
+	// Fset holds the positions of Files. It may be nil, in which case
+	// hints have no positions.
+	Fset  *token.FileSet
+	Files []*ast.File
+}
+
+// Hints compares the syntax of the old and new versions of a package and
+// returns advisory hints about changes in behavior, sorted by message. It
+// looks for
+//
+//   - exported functions and methods whose bodies call panic with new
+//     arguments,
+//   - exported variables whose initializers changed, and
+//   - exported objects whose doc comments lost a "Deprecated:" paragraph.
+//
+// The analysis is purely syntactic. Hints are typically stored in
+// Report.Hints, where they are reported separately from changes.
+func Hints(old, new *PackageSyntax) []Hint {
+	oldDecls := syntaxDecls(old)
+	newDecls := syntaxDecls(new)
+	var hints []Hint
+	add := func(nd *syntaxDecl, kind HintKind, pos token.Pos, format string, args ...interface{}) {
+		h := Hint{
+			Message: nd.name + ": " + fmt.Sprintf(format, args...),
+			Package: new.Path,
+			Object:  nd.name,
+			Kind:    kind,
+		}
+		if new.Fset != nil && pos.IsValid() {
+			h.Pos = new.Fset.Position(pos)
+		}
+		hints = append(hints, h)
+	}
+	for name, nd := range newDecls {
+		od := oldDecls[name]
+		if od == nil {
+			continue
+		}
+		if od.deprecated && !nd.deprecated {
+			add(nd, DeprecationRemoved, nd.pos, "deprecation notice removed")
+		}
+		if od.body != nil && nd.body != nil {
+			if calls := newPanics(old.Fset, od.body, new.Fset, nd.body); len(calls) > 0 {
+				var descs []string
+				for _, c := range calls {
+					descs = append(descs, "panic("+c.arg+")")
+				}
+				add(nd, NewPanic, calls[0].pos, "may now panic: %s", strings.Join(descs, ", "))
+			}
+		}
+		if od.init != nil && nd.init != nil {
+			if !equalSyntax(reflect.ValueOf(od.init), reflect.ValueOf(nd.init)) {
+				add(nd, InitializerChanged, nd.init.Pos(), "initializer changed")
+			}
+		}
+	}
+	sort.Slice(hints, func(i, j int) bool { return hints[i].Message < hints[j].Message })
+	return hints
+}
+
+// A syntaxDecl is the declaration of an exported object.
+type syntaxDecl struct {
+	name       string
+	pos        token.Pos
+	deprecated bool
+	body       *ast.BlockStmt // for functions and methods
+	init       ast.Expr       // for variables
+}
+
+// syntaxDecls returns the declarations of the exported package-level objects
+// and methods of ps, indexed by name.
+func syntaxDecls(ps *PackageSyntax) map[string]*syntaxDecl {
+	m := map[string]*syntaxDecl{}
+	for _, f := range ps.Files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				name, ok := funcDeclName(decl)
+				if !ok {
+					continue
+				}
+				m[name] = &syntaxDecl{
+					name:       name,
+					pos:        decl.Name.Pos(),
+					deprecated: IsDeprecated(decl.Doc),
+					body:       decl.Body,
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					doc := specDoc(decl, spec)
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if spec.Name.IsExported() {
+							m[spec.Name.Name] = &syntaxDecl{
+								name:       spec.Name.Name,
+								pos:        spec.Name.Pos(),
+								deprecated: IsDeprecated(doc),
+							}
+						}
+					case *ast.ValueSpec:
+						for i, id := range spec.Names {
+							if !id.IsExported() {
+								continue
+							}
+							sd := &syntaxDecl{
+								name:       id.Name,
+								pos:        id.Pos(),
+								deprecated: IsDeprecated(doc),
+							}
+							// Constant values are compared by Changes.
+							if decl.Tok == token.VAR {
+								switch len(spec.Values) {
+								case len(spec.Names):
+									sd.init = spec.Values[i]
+								case 1:
+									// var a, b = f()
+									sd.init = spec.Values[0]
+								}
+							}
+							m[id.Name] = sd
+						}
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// funcDeclName returns the name of a function or method in the form used by
+// Change.Object, and reports whether it is exported. A method is exported if
+// both it and its receiver's type name are.
+func funcDeclName(decl *ast.FuncDecl) (string, bool) {
+	if !decl.Name.IsExported() {
+		return "", false
+	}
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name, true
+	}
+	recv, ptr := ReceiverName(decl.Recv.List[0].Type)
+	if !ast.IsExported(recv) {
+		return "", false
+	}
+	if ptr {
+		return "(*" + recv + ")." + decl.Name.Name, true
+	}
+	return recv + "." + decl.Name.Name, true
+}
+
+// ReceiverName returns the name of the type of a method receiver expression,
+// like "T" for "*T", "(T)" or "T[P]", and reports whether the receiver is a
+// pointer. It returns "" if expr is not a valid receiver type.
+func ReceiverName(expr ast.Expr) (name string, pointer bool) {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			pointer = true
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			// Drop type parameters of generic receivers.
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name, pointer
+		default:
+			return "", false
+		}
+	}
+}
+
+// specDoc returns the doc comment of spec, or that of its declaration if the
+// declaration is not parenthesized.
+func specDoc(decl *ast.GenDecl, spec ast.Spec) *ast.CommentGroup {
+	var doc *ast.CommentGroup
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		doc = spec.Doc
+	case *ast.ValueSpec:
+		doc = spec.Doc
+	}
+	if doc == nil && !decl.Lparen.IsValid() {
+		doc = decl.Doc
+	}
+	return doc
+}
+
+// IsDeprecated reports whether doc has a paragraph that begins with
+// "Deprecated: ", the convention for marking deprecated APIs. Paragraphs are
+// separated by blank lines.
+func IsDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	paraStart := true
+	for _, line := range strings.Split(doc.Text(), "\n") {
+		if strings.TrimSpace(line) == "" {
+			paraStart = true
+			continue
+		}
+		if paraStart && strings.HasPrefix(line, "Deprecated: ") {
+			return true
+		}
+		paraStart = false
+	}
+	return false
+}
+
+// A panicCall is a call to the built-in panic.
+type panicCall struct {
+	arg string
+	pos token.Pos
+}
+
+// newPanics returns the calls to panic in the new body whose arguments do not
+// appear in calls to panic in the old body, counting repetitions.
+func newPanics(oldFset *token.FileSet, oldBody *ast.BlockStmt, newFset *token.FileSet, newBody *ast.BlockStmt) []panicCall {
+	seen := map[string]int{}
+	for _, c := range panicCalls(oldFset, oldBody) {
+		seen[c.arg]++
+	}
+	var calls []panicCall
+	for _, c := range panicCalls(newFset, newBody) {
+		if seen[c.arg] > 0 {
+			seen[c.arg]--
+			continue
+		}
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// panicCalls returns the calls to panic in body. Without type information,
+// a call to a local function named panic is also included.
+func panicCalls(fset *token.FileSet, body *ast.BlockStmt) []panicCall {
+	var calls []panicCall
+	ast.Inspect(body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		if id, ok := call.Fun.(*ast.Ident); ok && id.Name == "panic" {
+			calls = append(calls, panicCall{nodeString(fset, call.Args[0]), call.Pos()})
+		}
+		return true
+	})
+	return calls
+}
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+)
+
+// equalSyntax reports whether x and y, which are syntax trees or parts of
+// them, are the same apart from positions, comments and layout.
+func equalSyntax(x, y reflect.Value) bool {
+	if x.Type() != y.Type() {
+		return false
+	}
+	switch x.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return x.IsNil() == y.IsNil()
+		}
+		return equalSyntax(x.Elem(), y.Elem())
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			switch x.Type().Field(i).Type {
+			case posType, commentGroupType, objectType:
+				continue
+			}
+			if !equalSyntax(x.Field(i), y.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if x.Len() != y.Len() {
+			return false
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !equalSyntax(x.Index(i), y.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.String:
+		return x.String() == y.String()
+	case reflect.Bool:
+		return x.Bool() == y.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return x.Int() == y.Int()
+	}
+	// Syntax trees have no other kinds of values that matter.
+	return true
+}
+
+// nodeString formats n as Go source on a single line.
+func nodeString(fset *token.FileSet, n ast.Node) string {
+	if fset == nil {
+		fset = token.NewFileSet()
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, n); err != nil {
+		return fmt.Sprintf("!!%v", err)
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
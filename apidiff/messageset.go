@@ -5,6 +5,7 @@ package apidiff
 
 import (
 	"fmt"
+	"go/token"
 	"go/types"
 	"sort"
 	"strings"
@@ -15,30 +16,43 @@ import (
 //
 // The part thing is necessary. Method (Func) objects have sufficient info, but field
 // Vars do not: they just have a field name and a type, without the enclosing struct.
-type messageSet map[types.Object]map[string]string
+type messageSet map[types.Object]map[string]message
+
+// A message is the description of a single change, before it is associated
+// with an object and part.
+type message struct {
+	kind     ChangeKind
+	text     string
+	old, new string // see Change.Old and Change.New
+
+	oldPos, newPos token.Position // see Change.OldPos and Change.NewPos
+}
 
 // Add a message for obj and part, overwriting a previous message
 // (shouldn't happen).
 // obj is required but part can be empty.
-func (m messageSet) add(obj types.Object, part, msg string) {
+func (m messageSet) add(obj types.Object, part string, msg message) {
 	s := m[obj]
 	if s == nil {
-		s = map[string]string{}
+		s = map[string]message{}
 		m[obj] = s
 	}
-	if f, ok := s[part]; ok && f != msg {
+	if f, ok := s[part]; ok && f.text != msg.text {
 		fmt.Printf("! second, different message for obj %s, part %q\n", obj, part)
-		fmt.Printf("  first:  %s\n", f)
-		fmt.Printf("  second: %s\n", msg)
+		fmt.Printf("  first:  %s\n", f.text)
+		fmt.Printf("  second: %s\n", msg.text)
 	}
 	s[part] = msg
 }
 
-func (m messageSet) collect() []string {
-	var s []string
+// collect returns the changes in m, sorted by message. The import path of
+// each change is obtained by calling pathOf on the changed object.
+func (m messageSet) collect(compatible bool, pathOf func(types.Object) string) []Change {
+	var cs []Change
 	for obj, parts := range m {
 		// Format each object name relative to its own package.
 		objstring := objectString(obj)
+		pkgPath := pathOf(obj)
 		for part, msg := range parts {
 			var p string
 
@@ -47,11 +61,22 @@ func (m messageSet) collect() []string {
 			} else {
 				p = dotjoin(objstring, part)
 			}
-			s = append(s, p+": "+msg)
+			cs = append(cs, Change{
+				Message:    p + ": " + msg.text,
+				Compatible: compatible,
+				Package:    pkgPath,
+				Object:     objstring,
+				Part:       strings.TrimPrefix(part, ", "),
+				Kind:       msg.kind,
+				Old:        msg.old,
+				New:        msg.new,
+				OldPos:     msg.oldPos,
+				NewPos:     msg.newPos,
+			})
 		}
 	}
-	sort.Strings(s)
-	return s
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Message < cs[j].Message })
+	return cs
 }
 
 func objectString(obj types.Object) string {
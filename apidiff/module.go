@@ -0,0 +1,136 @@
+package apidiff
+
+import (
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// A Module is a set of packages that share a module path.
+type Module struct {
+	// Path is the module path. Every package in the module should have an
+	// import path that is Path or begins with Path followed by a slash.
+	Path     string
+	Packages []*types.Package
+}
+
+// ModuleChanges reports on the differences between the APIs of the old and
+// new versions of a module, as with the zero Config.
+//
+// Packages are paired by their import paths relative to their module paths,
+// so the module path itself may change, as it does between major versions.
+// Packages present only in old or only in new are reported as removed or
+// added. Paired packages are compared as by Changes, except that a defined
+// type may correspond to a type declared in a different package of the same
+// module. That lets a type move to another package, leaving an alias behind,
+// without being reported as removed or changed.
+func ModuleChanges(old, new *Module) Report {
+	return (&Config{}).ModuleChanges(old, new)
+}
+
+// ModuleChanges is like the ModuleChanges function, but classifies changes
+// according to c.
+func (c *Config) ModuleChanges(old, new *Module) Report {
+	d := newDiffer(c)
+	d.oldPkgs = d.addModule(old, d.oldRel)
+	d.newPkgs = d.addModule(new, d.newRel)
+
+	var r Report
+	var pairs [][2]*types.Package
+	for _, rel := range sortedKeys(d.oldPkgs, d.newPkgs) {
+		oldpkg, newpkg := d.oldPkgs[rel], d.newPkgs[rel]
+		switch {
+		case newpkg == nil:
+			d.reportPaths[oldpkg] = oldpkg.Path()
+			if compatible, ok := c.classify(Removed, false); ok {
+				r.Changes = append(r.Changes, Change{
+					Message:    "package removed",
+					Compatible: compatible,
+					Package:    oldpkg.Path(),
+					Kind:       Removed,
+				})
+			}
+		case oldpkg == nil:
+			d.reportPaths[newpkg] = newpkg.Path()
+			if compatible, ok := c.classify(Added, true); ok {
+				r.Changes = append(r.Changes, Change{
+					Message:    "package added",
+					Compatible: compatible,
+					Package:    newpkg.Path(),
+					Kind:       Added,
+				})
+			}
+		default:
+			d.reportPaths[oldpkg] = newpkg.Path()
+			d.reportPaths[newpkg] = newpkg.Path()
+			pairs = append(pairs, [2]*types.Package{oldpkg, newpkg})
+		}
+	}
+	for _, pair := range pairs {
+		d.old, d.new = pair[0], pair[1]
+		d.checkPackage()
+	}
+	d.checkImplementations()
+
+	r.Changes = append(r.Changes, d.incompatibles.collect(false, d.reportPath)...)
+	r.Changes = append(r.Changes, d.compatibles.collect(true, d.reportPath)...)
+	sort.SliceStable(r.Changes, func(i, j int) bool {
+		ci, cj := r.Changes[i], r.Changes[j]
+		if ci.Compatible != cj.Compatible {
+			return !ci.Compatible
+		}
+		return ci.Package < cj.Package
+	})
+	return r
+}
+
+// addModule records the relative path of each package of m in rels,
+// and returns the packages of m indexed by relative path.
+func (d *differ) addModule(m *Module, rels map[*types.Package]string) map[string]*types.Package {
+	byRel := map[string]*types.Package{}
+	for _, pkg := range m.Packages {
+		rel := m.RelativePath(pkg.Path())
+		rels[pkg] = rel
+		byRel[rel] = pkg
+	}
+	return byRel
+}
+
+// relPath returns the module-relative path of pkg, which must be one of the
+// packages being compared.
+func (d *differ) relPath(pkg *types.Package) (string, bool) {
+	if rel, ok := d.oldRel[pkg]; ok {
+		return rel, true
+	}
+	rel, ok := d.newRel[pkg]
+	return rel, ok
+}
+
+// RelativePath returns the import path pkgPath relative to the module path,
+// as used to pair the packages of two versions of the module: "" for the
+// package at the module root, and pkgPath unchanged if it is not in the
+// module.
+func (m *Module) RelativePath(pkgPath string) string {
+	if pkgPath == m.Path {
+		return ""
+	}
+	if m.Path != "" && strings.HasPrefix(pkgPath, m.Path+"/") {
+		return pkgPath[len(m.Path)+1:]
+	}
+	return pkgPath
+}
+
+func sortedKeys(ms ...map[string]*types.Package) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range ms {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
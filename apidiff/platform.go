@@ -0,0 +1,120 @@
+package apidiff
+
+import (
+	"sort"
+	"strings"
+)
+
+// A PlatformReport is the report of a comparison of two versions of an API
+// as built for a single platform.
+type PlatformReport struct {
+	// Platform names the platform, usually as GOOS/GOARCH, optionally
+	// followed by build tags, as in "linux/amd64,purego".
+	Platform string
+	Report   Report
+}
+
+// MergePlatforms merges the reports of comparisons made for several
+// platforms into a single report.
+//
+// A change that occurs on every platform appears once, as in any of the
+// reports. A change that occurs on only some platforms, such as the removal
+// of a function from the Windows build of a package, has those platforms in
+// its Platforms field, and its message ends with them, as in
+//
+//	Mmap: removed (only on windows/amd64)
+//
+// Hints are merged in the same way, separately from changes. Changes and
+// hints are identified by package and message, and keep the positions from
+// the first report they appear in.
+//
+// Suppressions should be applied to the merged report, not to the reports
+// being merged, whose Suppressed and StaleSuppressions are ignored.
+func MergePlatforms(reports []PlatformReport) Report {
+	type changeKey struct {
+		pkg, msg   string
+		compatible bool
+	}
+	type changeEntry struct {
+		change    Change
+		platforms []string
+	}
+	var changes []*changeEntry
+	changesByKey := map[changeKey]*changeEntry{}
+
+	type hintKey struct{ pkg, msg string }
+	type hintEntry struct {
+		hint      Hint
+		platforms []string
+	}
+	var hints []*hintEntry
+	hintsByKey := map[hintKey]*hintEntry{}
+
+	for _, pr := range reports {
+		for _, c := range pr.Report.Changes {
+			k := changeKey{c.Package, c.Message, c.Compatible}
+			e := changesByKey[k]
+			if e == nil {
+				e = &changeEntry{change: c}
+				changesByKey[k] = e
+				changes = append(changes, e)
+			}
+			e.platforms = append(e.platforms, pr.Platform)
+		}
+		for _, h := range pr.Report.Hints {
+			k := hintKey{h.Package, h.Message}
+			e := hintsByKey[k]
+			if e == nil {
+				e = &hintEntry{hint: h}
+				hintsByKey[k] = e
+				hints = append(hints, e)
+			}
+			e.platforms = append(e.platforms, pr.Platform)
+		}
+	}
+
+	// onlyOn returns the suffix of the message of a change or hint that
+	// occurs on the given platforms, or "" if it occurs on all of them.
+	onlyOn := func(platforms []string) string {
+		if len(platforms) == len(reports) {
+			return ""
+		}
+		return " (only on " + strings.Join(platforms, ", ") + ")"
+	}
+	var r Report
+	for _, e := range changes {
+		c := e.change
+		if suffix := onlyOn(e.platforms); suffix != "" {
+			c.Platforms = e.platforms
+			c.Message += suffix
+		}
+		r.Changes = append(r.Changes, c)
+	}
+	for _, e := range hints {
+		h := e.hint
+		if suffix := onlyOn(e.platforms); suffix != "" {
+			h.Platforms = e.platforms
+			h.Message += suffix
+		}
+		r.Hints = append(r.Hints, h)
+	}
+
+	// Order changes as ModuleChanges does.
+	sort.SliceStable(r.Changes, func(i, j int) bool {
+		ci, cj := r.Changes[i], r.Changes[j]
+		if ci.Compatible != cj.Compatible {
+			return !ci.Compatible
+		}
+		if ci.Package != cj.Package {
+			return ci.Package < cj.Package
+		}
+		return ci.Message < cj.Message
+	})
+	sort.SliceStable(r.Hints, func(i, j int) bool {
+		if r.Hints[i].Package != r.Hints[j].Package {
+			return r.Hints[i].Package < r.Hints[j].Package
+		}
+		return r.Hints[i].Message < r.Hints[j].Message
+	})
+	return r
+}
@@ -0,0 +1,82 @@
+package apidiff
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+)
+
+// positions returns the source positions of the old and new declarations of
+// obj, which may belong to either version. A position is the zero
+// token.Position if the corresponding file set is not configured or the
+// object does not exist in that version.
+func (d *differ) positions(obj types.Object) (old, new token.Position) {
+	if _, isOld := d.oldRel[obj.Pkg()]; isOld {
+		old = position(d.conf.OldFset, obj)
+		new = position(d.conf.NewFset, d.counterpart(obj, d.newPkgs))
+	} else {
+		old = position(d.conf.OldFset, d.counterpart(obj, d.oldPkgs))
+		new = position(d.conf.NewFset, obj)
+	}
+	return old, new
+}
+
+func position(fset *token.FileSet, obj types.Object) token.Position {
+	if fset == nil || obj == nil || !obj.Pos().IsValid() {
+		return token.Position{}
+	}
+	return fset.Position(obj.Pos())
+}
+
+// counterpart returns the object of the other version of the API that has
+// the same name as obj, or nil if there is none. The packages of the other
+// version are given by pkgs, indexed by relative path.
+func (d *differ) counterpart(obj types.Object, pkgs map[string]*types.Package) types.Object {
+	rel, ok := d.relPath(obj.Pkg())
+	if !ok {
+		return nil
+	}
+	pkg := pkgs[rel]
+	if pkg == nil {
+		return nil
+	}
+	f, ok := obj.(*types.Func)
+	if !ok || f.Type().(*types.Signature).Recv() == nil {
+		return pkg.Scope().Lookup(obj.Name())
+	}
+	// A method: look it up in the method set of the receiver type's
+	// counterpart.
+	recv := types.Unalias(f.Type().(*types.Signature).Recv().Type())
+	if p, ok := recv.(*types.Pointer); ok {
+		recv = types.Unalias(p.Elem())
+	}
+	named, ok := recv.(*types.Named)
+	if !ok {
+		return nil
+	}
+	tn, ok := pkg.Scope().Lookup(named.Obj().Name()).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	m, _, _ := types.LookupFieldOrMethod(tn.Type(), true, pkg, obj.Name())
+	return m
+}
+
+// Position returns the position of the declaration that c is most likely to
+// be about: the new declaration if there is one, or else the old.
+func (c Change) Position() token.Position {
+	if c.NewPos.IsValid() {
+		return c.NewPos
+	}
+	return c.OldPos
+}
+
+// positionString formats the position of c as "file:line", or returns the
+// empty string if c has no position.
+func (c Change) positionString() string {
+	pos := c.Position()
+	if !pos.IsValid() {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+}
@@ -0,0 +1,352 @@
+package apidiff
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// A Renderer writes a report in some format.
+//
+// The renderers in this package produce plain text, JSON, Markdown and HTML.
+// Other formats can be added by implementing Renderer.
+type Renderer interface {
+	Render(w io.Writer, r Report) error
+}
+
+// TextRenderer renders a report as plain text, as by Report.Text.
+type TextRenderer struct{}
+
+func (TextRenderer) Render(w io.Writer, r Report) error { return r.Text(w) }
+
+// JSONRenderer renders a report as JSON, as by Report.JSON.
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(w io.Writer, r Report) error { return r.JSON(w) }
+
+// MarkdownRenderer renders a report as Markdown, suitable for release notes
+// and code review comments. Incompatible and compatible changes, hints and
+// suppressed changes appear in separate sections, and within each section changes are grouped
+// by package and object.
+type MarkdownRenderer struct {
+	// Title, if non-empty, is written as a top-level heading.
+	Title string
+	// Link, if non-nil, returns the URL of the source of a change, or the
+	// empty string if there is none. The names of changed objects and parts
+	// link to that URL. If Link is nil, they link to the file and line of the
+	// change's position, if it has one.
+	Link func(Change) string
+}
+
+func (m *MarkdownRenderer) Render(w io.Writer, r Report) error {
+	ew := &errWriter{w: w}
+	if m.Title != "" {
+		ew.printf("# %s\n\n", MarkdownEscape(m.Title))
+	}
+	for _, s := range reportSections(r, m.Link) {
+		ew.printf("## %s\n\n", s.Title)
+		for _, p := range s.Packages {
+			ew.printf("### `%s`\n\n", p.Package)
+			for _, o := range p.Objects {
+				m.writeObject(ew, o)
+			}
+			ew.printf("\n")
+		}
+	}
+	if len(r.StaleSuppressions) > 0 {
+		ew.printf("## Stale suppressions\n\n")
+		for _, s := range r.StaleSuppressions {
+			ew.printf("- `%s` %s (%s): %s\n", s.Path, s.Kind, s.Pos, s.Reason)
+		}
+		ew.printf("\n")
+	}
+	return ew.err
+}
+
+func (m *MarkdownRenderer) writeObject(ew *errWriter, o objectChanges) {
+	// A change to a package as a whole has no object to name.
+	if o.Object == "" {
+		for _, c := range o.Changes {
+			ew.printf("- %s\n", mdItem(c))
+		}
+		return
+	}
+	name := mdLink("`"+o.Object+"`", o.Link)
+	if o.Pos != "" {
+		name += " (`" + o.Pos + "`)"
+	}
+	if o.Inline() {
+		ew.printf("- %s: %s\n", name, mdItem(o.Changes[0]))
+		return
+	}
+	ew.printf("- %s\n", name)
+	for _, c := range o.Changes {
+		if c.Part == "" {
+			ew.printf("  - %s\n", mdItem(c))
+		} else {
+			ew.printf("  - %s: %s\n", mdLink(MarkdownEscape(c.Part), c.Link), mdItem(c))
+		}
+	}
+}
+
+// mdItem formats the text of a change and its note, if any.
+func mdItem(c changeItem) string {
+	s := MarkdownEscape(c.Text)
+	if c.Note != "" {
+		s += " _(" + MarkdownEscape(c.Note) + ")_"
+	}
+	return s
+}
+
+func mdLink(text, url string) string {
+	if url == "" {
+		return text
+	}
+	return "[" + text + "](" + url + ")"
+}
+
+var mdEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+)
+
+// MarkdownEscape escapes the characters of s that Markdown could interpret,
+// such as the asterisks of pointer types and the brackets of slice types.
+// MarkdownRenderer escapes the text of changes with it.
+func MarkdownEscape(s string) string { return mdEscaper.Replace(s) }
+
+// HTMLRenderer renders a report as a self-contained HTML page. Incompatible
+// and compatible changes, hints and suppressed changes appear in separate,
+// distinctly colored sections, and within each section changes are grouped by package and
+// object.
+type HTMLRenderer struct {
+	// Title is the title of the page. If empty, "API changes" is used.
+	Title string
+	// Link, if non-nil, returns the URL of the source of a change, or the
+	// empty string if there is none. The names of changed objects and parts
+	// link to that URL. If Link is nil, they link to the file and line of the
+	// change's position, if it has one.
+	Link func(Change) string
+}
+
+func (h *HTMLRenderer) Render(w io.Writer, r Report) error {
+	title := h.Title
+	if title == "" {
+		title = "API changes"
+	}
+	return htmlTemplate.Execute(w, struct {
+		Title    string
+		Sections []reportSection
+		Stale    []StaleSuppression
+	}{title, reportSections(r, h.Link), r.StaleSuppressions})
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pair": func(text, link string) textLink { return textLink{text, link} },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+code { font-family: monospace; }
+section { border-left: 0.4em solid; margin: 1em 0; padding: 0 1em; }
+section.incompatible { border-color: #c62828; }
+section.incompatible h2 { color: #c62828; }
+section.compatible { border-color: #2e7d32; }
+section.compatible h2 { color: #2e7d32; }
+section.hints { border-color: #1565c0; }
+section.hints h2 { color: #1565c0; }
+section.suppressed, section.stale { border-color: #9e9e9e; }
+section.suppressed h2, section.stale h2 { color: #616161; }
+.note { color: #616161; font-style: italic; }
+.pos { color: #616161; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- range .Sections}}
+<section class="{{.Class}}">
+<h2>{{.Title}}</h2>
+{{- range .Packages}}
+<h3><code>{{.Package}}</code></h3>
+<ul>
+{{- range .Objects}}
+{{- if .Inline}}
+<li>{{template "link" (pair .Object .Link)}}{{template "pos" .Pos}}: {{template "item" index .Changes 0}}</li>
+{{- else if .Object}}
+<li>{{template "link" (pair .Object .Link)}}{{template "pos" .Pos}}
+<ul>
+{{- range .Changes}}
+<li>{{if .Part}}{{template "link" (pair .Part .Link)}}: {{end}}{{template "item" .}}</li>
+{{- end}}
+</ul>
+</li>
+{{- else}}
+{{- range .Changes}}
+<li>{{template "item" .}}</li>
+{{- end}}
+{{- end}}
+{{- end}}
+</ul>
+{{- end}}
+</section>
+{{- end}}
+{{- if .Stale}}
+<section class="stale">
+<h2>Stale suppressions</h2>
+<ul>
+{{- range .Stale}}
+<li><code>{{.Path}}</code> {{.Kind}} ({{.Pos}}): {{.Reason}}</li>
+{{- end}}
+</ul>
+</section>
+{{- end}}
+</body>
+</html>
+{{define "link"}}{{if .Link}}<a href="{{.Link}}"><code>{{.Text}}</code></a>{{else}}<code>{{.Text}}</code>{{end}}{{end}}
+{{- define "pos"}}{{if .}} <span class="pos">(<code>{{.}}</code>)</span>{{end}}{{end}}
+{{- define "item"}}{{.Text}}{{if .Note}} <span class="note">({{.Note}})</span>{{end}}{{end}}
+`))
+
+// A textLink is text that links to a URL, if Link is non-empty.
+type textLink struct{ Text, Link string }
+
+// A reportSection is one section of a rendered report: its incompatible,
+// compatible or suppressed changes, or its hints.
+type reportSection struct {
+	Title    string
+	Class    string
+	Packages []packageChanges
+}
+
+// packageChanges holds the changes to one package, grouped by object.
+type packageChanges struct {
+	Package string
+	Objects []objectChanges
+}
+
+// objectChanges holds the changes to one object. Object is empty for
+// changes to the package as a whole. Pos is the position of the object's
+// declaration as "file:line", or empty if it is unknown.
+type objectChanges struct {
+	Object  string
+	Link    string
+	Pos     string
+	Changes []changeItem
+}
+
+// Inline reports whether o consists of a single change to the object as a
+// whole, which is rendered on the same line as the object's name.
+func (o objectChanges) Inline() bool {
+	return o.Object != "" && len(o.Changes) == 1 && o.Changes[0].Part == ""
+}
+
+// A changeItem is a single change to an object, prepared for rendering.
+type changeItem struct {
+	Part string
+	Text string
+	Link string
+	// Note is additional information, such as the justification of a
+	// suppression.
+	Note string
+}
+
+// reportSections returns the non-empty sections of r, in order.
+func reportSections(r Report, link func(Change) string) []reportSection {
+	var ss []reportSection
+	add := func(title, class string, cs []Change, notes []string) {
+		if len(cs) > 0 {
+			ss = append(ss, reportSection{title, class, groupChanges(cs, notes, link)})
+		}
+	}
+	add("Incompatible changes", "incompatible", r.changes(false), nil)
+	add("Compatible changes", "compatible", r.changes(true), nil)
+	add("Hints", "hints", r.hintChanges(), nil)
+	var cs []Change
+	var notes []string
+	for _, sc := range r.Suppressed {
+		cs = append(cs, sc.Change)
+		notes = append(notes, sc.Suppression.Justification)
+	}
+	add("Suppressed changes", "suppressed", cs, notes)
+	return ss
+}
+
+// groupChanges groups cs by package and then by object, preserving the order
+// in which each package and object first appears. If notes is non-nil, it
+// holds a note for each change.
+func groupChanges(cs []Change, notes []string, link func(Change) string) []packageChanges {
+	var pkgs []packageChanges
+	pkgIndex := map[string]int{}
+	objIndex := map[[2]string]int{}
+	for i, c := range cs {
+		pi, ok := pkgIndex[c.Package]
+		if !ok {
+			pi = len(pkgs)
+			pkgIndex[c.Package] = pi
+			pkgs = append(pkgs, packageChanges{Package: c.Package})
+		}
+		p := &pkgs[pi]
+		key := [2]string{c.Package, c.Object}
+		oi, ok := objIndex[key]
+		if !ok {
+			oi = len(p.Objects)
+			objIndex[key] = oi
+			p.Objects = append(p.Objects, objectChanges{Object: c.Object})
+		}
+		o := &p.Objects[oi]
+		item := changeItem{Part: c.Part, Text: messageText(c)}
+		if link != nil {
+			item.Link = link(c)
+		} else {
+			item.Link = positionLink(c)
+		}
+		// The object links to the source of the change to the object as a
+		// whole, or failing that, of its first changed part.
+		if pos := c.positionString(); (o.Link == "" && o.Pos == "") || (c.Part == "" && o.Changes[0].Part != "") {
+			o.Link, o.Pos = item.Link, pos
+		}
+		if notes != nil {
+			item.Note = notes[i]
+		}
+		o.Changes = append(o.Changes, item)
+	}
+	return pkgs
+}
+
+// positionLink returns a URL for the file and line of the position of c, or
+// the empty string if c has no position. Absolute file names become file
+// URLs; relative ones stay relative, so that they resolve against the
+// location of the report.
+func positionLink(c Change) string {
+	pos := c.Position()
+	if !pos.IsValid() || pos.Filename == "" {
+		return ""
+	}
+	u := &url.URL{Path: filepath.ToSlash(pos.Filename), Fragment: fmt.Sprintf("L%d", pos.Line)}
+	if filepath.IsAbs(pos.Filename) {
+		u.Scheme = "file"
+		if !strings.HasPrefix(u.Path, "/") {
+			// A Windows path like C:/dir/file.go.
+			u.Path = "/" + u.Path
+		}
+	}
+	return u.String()
+}
+
+// An errWriter records the first error of a sequence of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
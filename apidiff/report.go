@@ -2,29 +2,131 @@ package apidiff
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/token"
 	"io"
+	"strings"
 )
 
 // Report describes the changes detected by Changes.
 type Report struct {
 	Changes []Change
+
+	// Hints holds advisory notes about changes in behavior, such as those
+	// returned by the Hints function. They never affect compatibility.
+	Hints []Hint `json:",omitempty"`
+
+	// Suppressed holds changes that were acknowledged by a suppression,
+	// and StaleSuppressions the suppressions that did not apply to any
+	// change. See Report.Suppress.
+	Suppressed        []SuppressedChange `json:",omitempty"`
+	StaleSuppressions []StaleSuppression `json:",omitempty"`
 }
 
 // A Change describes a single API change.
 type Change struct {
+	// Message is a human-readable description of the change, prefixed by the
+	// name of the changed object and part.
 	Message    string
 	Compatible bool
+
+	// Package is the import path of the package that declares the changed object.
+	Package string
+	// Object is the name of the changed object, qualified by its receiver type
+	// for methods, as in "(*T).M".
+	Object string
+	// Part names the affected part of the object, such as a struct field or
+	// interface method. It is empty if the change applies to the object as a whole.
+	Part string `json:",omitempty"`
+	// Kind classifies the change.
+	Kind ChangeKind
+	// Old and New describe the object before and after the change: types for
+	// TypeChanged, BecameTyped and BecameUntyped, values for ValueChanged and
+	// ValueNotRepresentable, object kinds for ObjectKindChanged, type
+	// parameter lists for TypeParamsChanged and constraints for
+	// ConstraintLoosened, ConstraintTightened and ConstraintChanged, tag
+	// values for TagChanged and TagRemoved, field lists for FieldsReordered
+	// and selectors for PromotionChanged. They are empty for other kinds of
+	// change.
+	Old string `json:",omitempty"`
+	New string `json:",omitempty"`
+	// OldPos and NewPos are the positions of the old and new declarations of
+	// the changed object. They are recorded only if the file sets of the
+	// packages are provided in the Config, and are the zero Position if
+	// the object does not exist in that version or its position is unknown.
+	// Zero positions are omitted from JSON.
+	OldPos token.Position
+	NewPos token.Position
+	// Platforms lists the platforms on which the change occurs, in a report
+	// merged by MergePlatforms. It is empty if the change occurs on all of
+	// them.
+	Platforms []string `json:",omitempty"`
+}
+
+// A ChangeKind is a stable code that classifies a Change. Its values may be
+// stored and compared across versions of this package.
+type ChangeKind string
+
+const (
+	Added                 ChangeKind = "added"
+	Removed               ChangeKind = "removed"
+	TypeChanged           ChangeKind = "type-changed"
+	ObjectKindChanged     ChangeKind = "object-kind-changed"
+	ValueChanged          ChangeKind = "value-changed"
+	ValueNotRepresentable ChangeKind = "value-not-representable"
+	BecameTyped           ChangeKind = "became-typed"
+	BecameUntyped         ChangeKind = "became-untyped"
+	DirectionChanged      ChangeKind = "direction-changed"
+	DirectionRemoved      ChangeKind = "direction-removed"
+	UnexportedMethodAdded ChangeKind = "unexported-method-added"
+	NoLongerImplements    ChangeKind = "no-longer-implements"
+	NoLongerComparable    ChangeKind = "no-longer-comparable"
+	TypeParamsChanged     ChangeKind = "type-params-changed"
+	ConstraintLoosened    ChangeKind = "constraint-loosened"
+	ConstraintTightened   ChangeKind = "constraint-tightened"
+	ConstraintChanged     ChangeKind = "constraint-changed"
+	TagChanged            ChangeKind = "tag-changed"
+	TagRemoved            ChangeKind = "tag-removed"
+	FieldsReordered       ChangeKind = "fields-reordered"
+	PromotionChanged      ChangeKind = "promotion-changed"
+)
+
+// MarshalJSON encodes c like encoding/json would by default, but omits the
+// zero positions.
+func (c Change) MarshalJSON() ([]byte, error) {
+	type change Change // without the MarshalJSON method
+	return json.Marshal(struct {
+		change
+		OldPos *token.Position `json:",omitempty"`
+		NewPos *token.Position `json:",omitempty"`
+	}{change(c), jsonPosition(c.OldPos), jsonPosition(c.NewPos)})
+}
+
+// jsonPosition returns a pointer to pos, or nil if pos is the zero Position.
+func jsonPosition(pos token.Position) *token.Position {
+	if pos == (token.Position{}) {
+		return nil
+	}
+	return &pos
 }
 
 func (r Report) messages(compatible bool) []string {
 	var msgs []string
+	for _, c := range r.changes(compatible) {
+		msgs = append(msgs, c.Message)
+	}
+	return msgs
+}
+
+func (r Report) changes(compatible bool) []Change {
+	var cs []Change
 	for _, c := range r.Changes {
 		if c.Compatible == compatible {
-			msgs = append(msgs, c.Message)
+			cs = append(cs, c)
 		}
 	}
-	return msgs
+	return cs
 }
 
 func (r Report) String() string {
@@ -39,22 +141,91 @@ func (r Report) Text(w io.Writer) error {
 	if err := r.TextIncompatible(w, true); err != nil {
 		return err
 	}
-	return r.TextCompatible(w)
+	if err := r.TextCompatible(w); err != nil {
+		return err
+	}
+	if err := r.TextHints(w); err != nil {
+		return err
+	}
+	return r.TextSuppressed(w)
 }
 
 func (r Report) TextIncompatible(w io.Writer, withHeader bool) error {
 	if withHeader {
-		return r.writeMessages(w, "Incompatible changes:", r.messages(false))
+		return r.writeMessages(w, "Incompatible changes:", r.changes(false))
 	}
-	return r.writeMessages(w, "", r.messages(false))
+	return r.writeMessages(w, "", r.changes(false))
 }
 
 func (r Report) TextCompatible(w io.Writer) error {
-	return r.writeMessages(w, "Compatible changes:", r.messages(true))
+	return r.writeMessages(w, "Compatible changes:", r.changes(true))
+}
+
+// TextHints writes the hints of r.
+func (r Report) TextHints(w io.Writer) error {
+	return r.writeMessages(w, "Hints:", r.hintChanges())
 }
 
-func (r Report) writeMessages(w io.Writer, header string, msgs []string) error {
-	if len(msgs) == 0 {
+// hintChanges returns the hints of r in the form of changes, for uniform
+// formatting. They are all marked compatible.
+func (r Report) hintChanges() []Change {
+	var cs []Change
+	for _, h := range r.Hints {
+		cs = append(cs, Change{
+			Message:    h.Message,
+			Compatible: true,
+			Package:    h.Package,
+			Object:     h.Object,
+			NewPos:     h.Pos,
+		})
+	}
+	return cs
+}
+
+// TextSuppressed writes the suppressed changes of r, with the justification
+// for each, followed by the stale suppressions.
+func (r Report) TextSuppressed(w io.Writer) error {
+	if len(r.Suppressed) > 0 {
+		if _, err := fmt.Fprintf(w, "Suppressed changes:\n"); err != nil {
+			return err
+		}
+		for _, sc := range r.Suppressed {
+			line := sc.ObjectPath() + ": " + messageText(sc.Change)
+			if j := sc.Suppression.Justification; j != "" {
+				line += " (" + j + ")"
+			}
+			if _, err := fmt.Fprintf(w, "- %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+	if len(r.StaleSuppressions) > 0 {
+		if _, err := fmt.Fprintf(w, "Stale suppressions:\n"); err != nil {
+			return err
+		}
+		for _, s := range r.StaleSuppressions {
+			if _, err := fmt.Fprintf(w, "- %s: %s %s: %s\n", s.Pos, s.Path, s.Kind, s.Reason); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// messageText returns the message of c without the object and part prefix.
+func messageText(c Change) string {
+	if i := strings.Index(c.Message, ": "); i >= 0 {
+		return c.Message[i+2:]
+	}
+	return c.Message
+}
+
+// writeMessages writes the messages of changes under header. If the changes
+// span more than one package, as in a report from ModuleChanges, each
+// package's messages are preceded by its import path. Messages of changes
+// with a known position are prefixed by it, as "file:line".
+func (r Report) writeMessages(w io.Writer, header string, changes []Change) error {
+	if len(changes) == 0 {
 		return nil
 	}
 	if header != "" {
@@ -62,10 +233,43 @@ func (r Report) writeMessages(w io.Writer, header string, msgs []string) error {
 			return err
 		}
 	}
-	for _, m := range msgs {
-		if _, err := fmt.Fprintf(w, "- %s\n", m); err != nil {
+	multi := false
+	for _, c := range changes {
+		if c.Package != changes[0].Package {
+			multi = true
+			break
+		}
+	}
+	for i, c := range changes {
+		if multi && (i == 0 || c.Package != changes[i-1].Package) {
+			if _, err := fmt.Fprintf(w, "%s:\n", c.Package); err != nil {
+				return err
+			}
+		}
+		line := c.Message
+		if pos := c.positionString(); pos != "" {
+			line = pos + ": " + line
+		}
+		if _, err := fmt.Fprintf(w, "- %s\n", line); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// JSON writes the report to w as indented JSON. The result can be decoded
+// with ReadJSON.
+func (r Report) JSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(r)
+}
+
+// ReadJSON decodes a report written by Report.JSON.
+func ReadJSON(r io.Reader) (Report, error) {
+	var rep Report
+	if err := json.NewDecoder(r).Decode(&rep); err != nil {
+		return Report{}, err
+	}
+	return rep, nil
+}
@@ -0,0 +1,100 @@
+package apidiff
+
+import (
+	"go/constant"
+	"go/token"
+	"go/types"
+	"math"
+)
+
+// Sized numeric types whose representability of a constant value is checked.
+// Types whose size depends on the architecture are omitted; int and uint are
+// covered by their 32- and 64-bit counterparts.
+var representabilityKinds = []types.BasicKind{
+	types.Int8, types.Int16, types.Int32, types.Int64,
+	types.Uint8, types.Uint16, types.Uint32, types.Uint64,
+	types.Float32, types.Float64,
+	types.Complex64, types.Complex128,
+}
+
+// lostRepresentations returns the names of the sized numeric types that can
+// represent the old value but not the new. Client code may assign or convert
+// a constant to any such type, so losing representability breaks it.
+func lostRepresentations(old, new constant.Value) []string {
+	if old.Kind() == constant.Unknown || new.Kind() == constant.Unknown {
+		// A value is unknown if its declaration has errors; nothing can be
+		// said about its representability.
+		return nil
+	}
+	var lost []string
+	for _, k := range representabilityKinds {
+		if representable(old, k) && !representable(new, k) {
+			lost = append(lost, types.Typ[k].Name())
+		}
+	}
+	return lost
+}
+
+// representable reports whether a constant of type k can hold v. It is a
+// simplified form of the check performed by go/types: float and complex
+// values are representable if they are finite after rounding.
+func representable(v constant.Value, k types.BasicKind) bool {
+	switch k {
+	case types.Int8:
+		return intInRange(v, math.MinInt8, math.MaxInt8)
+	case types.Int16:
+		return intInRange(v, math.MinInt16, math.MaxInt16)
+	case types.Int32:
+		return intInRange(v, math.MinInt32, math.MaxInt32)
+	case types.Int64:
+		return intInRange(v, math.MinInt64, math.MaxInt64)
+	case types.Uint8:
+		return uintInRange(v, math.MaxUint8)
+	case types.Uint16:
+		return uintInRange(v, math.MaxUint16)
+	case types.Uint32:
+		return uintInRange(v, math.MaxUint32)
+	case types.Uint64:
+		return uintInRange(v, math.MaxUint64)
+	case types.Float32, types.Float64:
+		return finiteFloat(v, k == types.Float32)
+	case types.Complex64, types.Complex128:
+		c := constant.ToComplex(v)
+		if c.Kind() != constant.Complex {
+			return false
+		}
+		return finiteFloat(constant.Real(c), k == types.Complex64) &&
+			finiteFloat(constant.Imag(c), k == types.Complex64)
+	}
+	return false
+}
+
+func intInRange(v constant.Value, min, max int64) bool {
+	i := constant.ToInt(v)
+	if i.Kind() != constant.Int {
+		return false
+	}
+	return constant.Compare(i, token.GEQ, constant.MakeInt64(min)) &&
+		constant.Compare(i, token.LEQ, constant.MakeInt64(max))
+}
+
+func uintInRange(v constant.Value, max uint64) bool {
+	i := constant.ToInt(v)
+	if i.Kind() != constant.Int {
+		return false
+	}
+	return constant.Sign(i) >= 0 && constant.Compare(i, token.LEQ, constant.MakeUint64(max))
+}
+
+func finiteFloat(v constant.Value, is32 bool) bool {
+	f := constant.ToFloat(v)
+	if f.Kind() != constant.Float && f.Kind() != constant.Int {
+		return false
+	}
+	if is32 {
+		x, _ := constant.Float32Val(f)
+		return !math.IsInf(float64(x), 0)
+	}
+	x, _ := constant.Float64Val(f)
+	return !math.IsInf(x, 0)
+}
@@ -0,0 +1,631 @@
+package apidiff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// API snapshots.
+//
+// A snapshot is a textual description of the API of a module, written by
+// WriteSnapshot and read by ParseSnapshot. Unlike export data, it does not
+// depend on the compiler's format, so a snapshot can be checked in to a
+// repository as the baseline against which the API is compared. Its format
+// is designed to produce readable diffs.
+//
+// A snapshot begins with the lines
+//
+//	// apidiff API snapshot v1
+//	// module example.com/m
+//
+// followed by a section for each package. A section is a Go source file that
+// declares the package's API, with function bodies omitted. Its package
+// clause records the import path:
+//
+//	package p // import "example.com/m/p"
+//
+// The sections of the module's packages declare all their exported objects,
+// along with the unexported types those objects expose. Other packages whose
+// types appear in the API follow, marked
+//
+//	package io // import "io" external
+//
+// and declare just enough of those types for the API to be compared: the
+// type parameters and exported and embedded fields of each type, its
+// methods if it is embedded, and whether it is comparable.
+
+// snapshotVersion is the version of the snapshot format written by
+// WriteSnapshot.
+const snapshotVersion = "v1"
+
+// SnapshotHeader begins the first line of every snapshot, which continues
+// with the version of the snapshot format.
+const SnapshotHeader = "// apidiff API snapshot "
+
+// WriteSnapshot writes a snapshot of the API of m to w.
+func WriteSnapshot(w io.Writer, m *Module) error {
+	sw := &snapshotWriter{
+		modPkgs:  map[*types.Package]bool{},
+		decls:    map[*types.Package][]types.Object{},
+		recorded: map[types.Object]bool{},
+		embedded: map[*types.TypeName]bool{},
+		methods:  map[*types.TypeName]bool{},
+		tparams:  map[*types.TypeParam]bool{},
+	}
+	for _, pkg := range m.Packages {
+		sw.modPkgs[pkg] = true
+	}
+	for _, pkg := range m.Packages {
+		if _, ok := sw.decls[pkg]; !ok {
+			sw.decls[pkg] = nil // write a section even if the package is empty
+		}
+		for _, name := range pkg.Scope().Names() {
+			if obj := pkg.Scope().Lookup(name); obj.Exported() {
+				sw.record(obj)
+			}
+		}
+	}
+	for len(sw.queue) > 0 {
+		tn := sw.queue[0]
+		sw.queue = sw.queue[1:]
+		sw.walkTypeName(tn)
+	}
+
+	var pkgs []*types.Package
+	for pkg := range sw.decls {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		pi, pj := pkgs[i], pkgs[j]
+		if sw.modPkgs[pi] != sw.modPkgs[pj] {
+			return sw.modPkgs[pi]
+		}
+		return pi.Path() < pj.Path()
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s%s\n// module %s\n", SnapshotHeader, snapshotVersion, m.Path)
+	for _, pkg := range pkgs {
+		src, err := sw.section(pkg)
+		if err != nil {
+			return fmt.Errorf("writing snapshot of %s: %v", pkg.Path(), err)
+		}
+		buf.WriteString("\n")
+		buf.Write(src)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type snapshotWriter struct {
+	modPkgs map[*types.Package]bool
+	// The objects to declare in each package's section.
+	decls    map[*types.Package][]types.Object
+	recorded map[types.Object]bool
+	// Type names whose declarations have yet to be walked.
+	queue []*types.TypeName
+	// External types that are embedded, and so need their methods.
+	embedded map[*types.TypeName]bool
+	// Type names whose methods have been walked.
+	methods map[*types.TypeName]bool
+	tparams map[*types.TypeParam]bool
+}
+
+// record arranges for obj to be declared in its package's section.
+func (sw *snapshotWriter) record(obj types.Object) {
+	if sw.recorded[obj] {
+		return
+	}
+	sw.recorded[obj] = true
+	pkg := obj.Pkg()
+	sw.decls[pkg] = append(sw.decls[pkg], obj)
+	switch obj := obj.(type) {
+	case *types.TypeName:
+		sw.queue = append(sw.queue, obj)
+	default:
+		sw.walk(obj.Type())
+	}
+}
+
+// walkTypeName walks the declaration of a recorded type name.
+func (sw *snapshotWriter) walkTypeName(tn *types.TypeName) {
+	switch t := tn.Type().(type) {
+	case *types.Alias:
+		sw.walkTypeParams(t.TypeParams())
+		sw.walk(t.Rhs())
+	case *types.Named:
+		sw.walkTypeParams(t.TypeParams())
+		if s, ok := t.Underlying().(*types.Struct); ok && !sw.modPkgs[tn.Pkg()] {
+			for _, f := range externalFields(s) {
+				sw.walkField(f)
+			}
+		} else {
+			sw.walk(t.Underlying())
+		}
+		sw.walkMethods(tn)
+	}
+}
+
+// walkMethods walks the methods of a defined type, if they will be declared.
+func (sw *snapshotWriter) walkMethods(tn *types.TypeName) {
+	if sw.methods[tn] || (!sw.modPkgs[tn.Pkg()] && !sw.embedded[tn]) {
+		return
+	}
+	sw.methods[tn] = true
+	for _, m := range sw.declaredMethods(tn) {
+		sw.walk(m.Type())
+	}
+}
+
+// declaredMethods returns the methods to declare for the defined type tn:
+// all of them in a package of the module, and the exported ones otherwise.
+func (sw *snapshotWriter) declaredMethods(tn *types.TypeName) []*types.Func {
+	named := tn.Type().(*types.Named)
+	if _, ok := named.Underlying().(*types.Interface); ok {
+		return nil
+	}
+	var ms []*types.Func
+	for i := 0; i < named.NumMethods(); i++ {
+		if m := named.Method(i); m.Exported() || sw.modPkgs[tn.Pkg()] {
+			ms = append(ms, m)
+		}
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name() < ms[j].Name() })
+	return ms
+}
+
+func (sw *snapshotWriter) walkTypeParams(tps *types.TypeParamList) {
+	for i := 0; i < tps.Len(); i++ {
+		sw.walk(tps.At(i))
+	}
+}
+
+func (sw *snapshotWriter) walkField(f *types.Var) {
+	if f.Anonymous() {
+		t := types.Unalias(f.Type())
+		if p, ok := t.(*types.Pointer); ok {
+			t = types.Unalias(p.Elem())
+		}
+		if n, ok := t.(*types.Named); ok && n.Obj().Pkg() != nil {
+			tn := n.Origin().Obj()
+			sw.embedded[tn] = true
+			if sw.recorded[tn] {
+				sw.walkMethods(tn)
+			}
+		}
+	}
+	sw.walk(f.Type())
+}
+
+// walk records the named types that appear in t.
+func (sw *snapshotWriter) walk(t types.Type) {
+	switch t := t.(type) {
+	case *types.Alias:
+		if t.Obj().Pkg() != nil {
+			sw.record(t.Obj())
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			sw.walk(t.TypeArgs().At(i))
+		}
+	case *types.Named:
+		if t.Obj().Pkg() != nil {
+			sw.record(t.Origin().Obj())
+		}
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			sw.walk(t.TypeArgs().At(i))
+		}
+	case *types.Pointer:
+		sw.walk(t.Elem())
+	case *types.Slice:
+		sw.walk(t.Elem())
+	case *types.Array:
+		sw.walk(t.Elem())
+	case *types.Chan:
+		sw.walk(t.Elem())
+	case *types.Map:
+		sw.walk(t.Key())
+		sw.walk(t.Elem())
+	case *types.Signature:
+		sw.walkTypeParams(t.TypeParams())
+		for _, tup := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tup.Len(); i++ {
+				sw.walk(tup.At(i).Type())
+			}
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			sw.walkField(t.Field(i))
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			sw.walk(t.ExplicitMethod(i).Type())
+		}
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			sw.walk(t.EmbeddedType(i))
+		}
+	case *types.Union:
+		for i := 0; i < t.Len(); i++ {
+			sw.walk(t.Term(i).Type())
+		}
+	case *types.TypeParam:
+		if !sw.tparams[t] {
+			sw.tparams[t] = true
+			sw.walk(t.Constraint())
+		}
+	}
+}
+
+// externalFields returns the fields of a struct from outside the module that
+// are declared in a snapshot: the exported and embedded ones.
+func externalFields(s *types.Struct) []*types.Var {
+	var fs []*types.Var
+	for i := 0; i < s.NumFields(); i++ {
+		if f := s.Field(i); f.Exported() || f.Anonymous() {
+			fs = append(fs, f)
+		}
+	}
+	return fs
+}
+
+// section returns the formatted source of the section for pkg.
+func (sw *snapshotWriter) section(pkg *types.Package) ([]byte, error) {
+	objs := sw.decls[pkg]
+	sort.Slice(objs, func(i, j int) bool {
+		ki, kj := declOrder(objs[i]), declOrder(objs[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return objs[i].Name() < objs[j].Name()
+	})
+	q := &importQualifier{pkg: pkg, names: map[*types.Package]string{}, used: map[string]bool{}}
+	for _, obj := range objs {
+		q.used[obj.Name()] = true
+	}
+
+	var body bytes.Buffer
+	for _, obj := range objs {
+		sw.writeDecl(&body, obj, q)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s // import %q", pkg.Name(), pkg.Path())
+	if !sw.modPkgs[pkg] {
+		buf.WriteString(" external")
+	}
+	buf.WriteString("\n")
+	if len(q.imports) > 0 {
+		sort.Slice(q.imports, func(i, j int) bool { return q.imports[i].Path() < q.imports[j].Path() })
+		buf.WriteString("\nimport (\n")
+		for _, ip := range q.imports {
+			fmt.Fprintf(&buf, "\t%s %q\n", q.names[ip], ip.Path())
+		}
+		buf.WriteString(")\n")
+	}
+	buf.Write(body.Bytes())
+	return format.Source(buf.Bytes())
+}
+
+func declOrder(obj types.Object) int {
+	switch obj.(type) {
+	case *types.Const:
+		return 0
+	case *types.Var:
+		return 1
+	case *types.TypeName:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// An importQualifier qualifies the names of other packages in a section,
+// choosing an unused name for each imported package.
+type importQualifier struct {
+	pkg     *types.Package
+	names   map[*types.Package]string
+	used    map[string]bool
+	imports []*types.Package
+}
+
+func (q *importQualifier) qualify(pkg *types.Package) string {
+	if pkg == q.pkg {
+		return ""
+	}
+	if name, ok := q.names[pkg]; ok {
+		return name
+	}
+	name := pkg.Name()
+	for i := 2; q.used[name]; i++ {
+		name = fmt.Sprintf("%s%d", pkg.Name(), i)
+	}
+	q.used[name] = true
+	q.names[pkg] = name
+	q.imports = append(q.imports, pkg)
+	return name
+}
+
+func (sw *snapshotWriter) writeDecl(w *bytes.Buffer, obj types.Object, q *importQualifier) {
+	ts := func(t types.Type) string { return types.TypeString(t, q.qualify) }
+	switch obj := obj.(type) {
+	case *types.Const:
+		fmt.Fprintf(w, "\nconst %s", obj.Name())
+		if !isUntyped(obj.Type()) {
+			fmt.Fprintf(w, " %s", ts(obj.Type()))
+		}
+		fmt.Fprintf(w, " = %s\n", constLiteral(obj))
+	case *types.Var:
+		fmt.Fprintf(w, "\nvar %s %s\n", obj.Name(), ts(obj.Type()))
+	case *types.Func:
+		fmt.Fprintf(w, "\nfunc %s%s\n", obj.Name(), strings.TrimPrefix(ts(obj.Type()), "func"))
+	case *types.TypeName:
+		switch t := obj.Type().(type) {
+		case *types.Alias:
+			fmt.Fprintf(w, "\ntype %s%s = %s\n", obj.Name(), typeParamList(t.TypeParams(), ts), ts(t.Rhs()))
+		case *types.Named:
+			fmt.Fprintf(w, "\ntype %s%s ", obj.Name(), typeParamList(t.TypeParams(), ts))
+			switch u := t.Underlying().(type) {
+			case *types.Struct:
+				fields := externalFields(u)
+				if sw.modPkgs[obj.Pkg()] {
+					fields = nil
+					for i := 0; i < u.NumFields(); i++ {
+						fields = append(fields, u.Field(i))
+					}
+				}
+				w.WriteString("struct {\n")
+				for _, f := range fields {
+					tag := u.Tag(fieldIndex(u, f))
+					if f.Anonymous() {
+						w.WriteString("\t" + ts(f.Type()))
+					} else {
+						w.WriteString("\t" + f.Name() + " " + ts(f.Type()))
+					}
+					if tag != "" && !strings.Contains(tag, "`") {
+						w.WriteString(" `" + tag + "`")
+					} else if tag != "" {
+						w.WriteString(" " + strconv.Quote(tag))
+					}
+					w.WriteString("\n")
+				}
+				// Preserve the incomparability of an external struct whose
+				// omitted fields are not comparable.
+				if len(fields) < u.NumFields() && !structComparable(u) && structComparable(types.NewStruct(fields, nil)) {
+					w.WriteString("\t_ [0]func()\n")
+				}
+				w.WriteString("}\n")
+			case *types.Interface:
+				w.WriteString("interface {\n")
+				for i := 0; i < u.NumExplicitMethods(); i++ {
+					m := u.ExplicitMethod(i)
+					fmt.Fprintf(w, "\t%s%s\n", m.Name(), strings.TrimPrefix(ts(m.Type()), "func"))
+				}
+				for i := 0; i < u.NumEmbeddeds(); i++ {
+					fmt.Fprintf(w, "\t%s\n", ts(u.EmbeddedType(i)))
+				}
+				w.WriteString("}\n")
+			default:
+				fmt.Fprintf(w, "%s\n", ts(u))
+			}
+			if sw.methods[obj] {
+				for _, m := range sw.declaredMethods(obj) {
+					sig := m.Type().(*types.Signature)
+					recv := ts(sig.Recv().Type())
+					fmt.Fprintf(w, "\nfunc (%s) %s%s\n", recv, m.Name(), strings.TrimPrefix(ts(sig), "func"))
+				}
+			}
+		}
+	}
+}
+
+func fieldIndex(s *types.Struct, f *types.Var) int {
+	for i := 0; i < s.NumFields(); i++ {
+		if s.Field(i) == f {
+			return i
+		}
+	}
+	return -1
+}
+
+// typeParamList formats a type parameter list for a declaration, or returns
+// the empty string if there are no type parameters.
+func typeParamList(tps *types.TypeParamList, ts func(types.Type) string) string {
+	if tps.Len() == 0 {
+		return ""
+	}
+	var parts []string
+	for i := 0; i < tps.Len(); i++ {
+		tp := tps.At(i)
+		parts = append(parts, tp.Obj().Name()+" "+ts(tp.Constraint()))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// constLiteral returns an expression for the value of c that has the same
+// kind as c, if c is untyped.
+func constLiteral(c *types.Const) string {
+	v := c.Val()
+	kind := types.Invalid
+	if b, ok := c.Type().Underlying().(*types.Basic); ok {
+		kind = b.Kind()
+	}
+	switch v.Kind() {
+	case constant.Bool, constant.String:
+		return v.ExactString()
+	case constant.Int:
+		switch kind {
+		case types.UntypedRune:
+			if r, ok := constant.Int64Val(v); ok && r >= 0 && r <= 0x10ffff {
+				return strconv.QuoteRune(rune(r))
+			}
+			return "rune(" + v.ExactString() + ")"
+		case types.UntypedFloat:
+			return floatLiteral(v)
+		case types.UntypedComplex:
+			return "complex(" + floatLiteral(v) + ", 0)"
+		}
+		return v.ExactString()
+	case constant.Float:
+		if kind == types.UntypedComplex {
+			return "complex(" + floatLiteral(v) + ", 0)"
+		}
+		return floatLiteral(v)
+	case constant.Complex:
+		return "complex(" + floatLiteral(constant.Real(v)) + ", " + floatLiteral(constant.Imag(v)) + ")"
+	}
+	return v.ExactString()
+}
+
+// floatLiteral returns an untyped float constant expression for v.
+func floatLiteral(v constant.Value) string {
+	// Prefer the short form of v, if it is exact.
+	if s := v.String(); strings.ContainsAny(s, ".eE") {
+		if constant.Compare(constant.MakeFromLiteral(s, token.FLOAT, 0), token.EQL, v) {
+			return s
+		}
+	}
+	s := v.ExactString()
+	if strings.ContainsAny(s, ".eEpP") {
+		return s
+	}
+	// An integer, or a fraction of integers.
+	if i := strings.Index(s, "/"); i >= 0 {
+		return s[:i] + ".0" + s[i:]
+	}
+	return s + ".0"
+}
+
+var snapshotPackageLine = regexp.MustCompile(`^package (\w+) // import ("[^"]*")( external)?$`)
+
+// ParseSnapshot parses a snapshot written by WriteSnapshot and type-checks
+// its packages. The filename is used in error messages and in the positions
+// recorded in fset. It returns the module described by the snapshot, whose
+// packages have the import paths of the packages the snapshot was written
+// from.
+func ParseSnapshot(fset *token.FileSet, filename string, data []byte) (*Module, error) {
+	type section struct {
+		path     string
+		external bool
+		line     int // line of the package clause
+		src      bytes.Buffer
+	}
+	var (
+		m        = &Module{}
+		sections = map[string]*section{}
+		order    []*section
+		cur      *section
+		version  string
+	)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := s.Text()
+		if cur == nil {
+			switch {
+			case strings.HasPrefix(text, SnapshotHeader):
+				version = strings.TrimPrefix(text, SnapshotHeader)
+				if version != snapshotVersion {
+					return nil, fmt.Errorf("%s:%d: unsupported snapshot version %q", filename, line, version)
+				}
+				continue
+			case strings.HasPrefix(text, "// module "):
+				m.Path = strings.TrimPrefix(text, "// module ")
+				continue
+			}
+		}
+		if match := snapshotPackageLine.FindStringSubmatch(text); match != nil {
+			path, err := strconv.Unquote(match[2])
+			if err != nil || sections[path] != nil {
+				return nil, fmt.Errorf("%s:%d: bad package clause", filename, line)
+			}
+			cur = &section{path: path, external: match[3] != "", line: line}
+			sections[path] = cur
+			order = append(order, cur)
+		}
+		if cur == nil {
+			if strings.TrimSpace(text) != "" {
+				return nil, fmt.Errorf("%s:%d: unexpected text before the first package", filename, line)
+			}
+			continue
+		}
+		cur.src.WriteString(text)
+		cur.src.WriteString("\n")
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if version == "" {
+		return nil, fmt.Errorf("%s: not an API snapshot", filename)
+	}
+
+	pkgs := map[string]*types.Package{}
+	checking := map[string]bool{}
+	var check func(path string) (*types.Package, error)
+	check = func(path string) (*types.Package, error) {
+		if path == "unsafe" {
+			return types.Unsafe, nil
+		}
+		if pkg := pkgs[path]; pkg != nil {
+			return pkg, nil
+		}
+		sec := sections[path]
+		if sec == nil {
+			return nil, fmt.Errorf("no package %s in snapshot", path)
+		}
+		if checking[path] {
+			return nil, fmt.Errorf("import cycle through %s", path)
+		}
+		checking[path] = true
+		// Start with a line directive so that positions refer to lines of
+		// the snapshot.
+		src := fmt.Sprintf("//line %s:%d:1\n%s", filename, sec.line, sec.src.Bytes())
+		f, err := parser.ParseFile(fset, filename, src, 0)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		conf := types.Config{
+			Importer: snapshotImporter(check),
+			Error: func(err error) {
+				// Function bodies are omitted, which go/types only allows
+				// for non-generic functions.
+				if strings.HasSuffix(err.Error(), "missing function body") {
+					return
+				}
+				if firstErr == nil {
+					firstErr = err
+				}
+			},
+		}
+		pkg, _ := conf.Check(path, fset, []*ast.File{f}, nil)
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		pkgs[path] = pkg
+		return pkg, nil
+	}
+	for _, sec := range order {
+		pkg, err := check(sec.path)
+		if err != nil {
+			return nil, err
+		}
+		if !sec.external {
+			m.Packages = append(m.Packages, pkg)
+		}
+	}
+	return m, nil
+}
+
+type snapshotImporter func(path string) (*types.Package, error)
+
+func (f snapshotImporter) Import(path string) (*types.Package, error) { return f(path) }
@@ -0,0 +1,162 @@
+package apidiff
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// Optional struct checks.
+//
+// The checks in this file find changes that have no compile-time
+// implications, or that the definition of compatibility deliberately
+// ignores, but that can still break clients. They are enabled by fields of
+// Config.
+//
+// Struct tags are read by encoders such as encoding/json, so changing or
+// removing the tag of a field can change how values are encoded. Adding a
+// tag can also, since it may replace a default, such as the field name.
+//
+// Reordering the fields of a struct breaks unkeyed struct literals, which
+// clients can write if all the fields are exported. If the reordered fields
+// have the same types, such literals still compile but assign the wrong
+// fields.
+//
+// A method of a struct type may be promoted from an embedded field. If it is
+// promoted from a different field, or declared directly instead, the method
+// set is unchanged but calls run different code.
+
+// checkStructTags compares the values of the configured tag keys for the
+// exported fields present in both old and new.
+func (d *differ) checkStructTags(obj types.Object, old, new *types.Struct) {
+	oldTags := exportedFieldTags(old)
+	newTags := exportedFieldTags(new)
+	for name, otag := range oldTags {
+		ntag, ok := newTags[name]
+		if !ok {
+			continue
+		}
+		for _, key := range d.conf.TagKeys {
+			ov, ook := otag.Lookup(key)
+			nv, nok := ntag.Lookup(key)
+			part := fmt.Sprintf("%s, %s tag", name, key)
+			oq, nq := fmt.Sprintf("%q", ov), fmt.Sprintf("%q", nv)
+			switch {
+			case ook && !nok:
+				d.add(false, obj, part, message{kind: TagRemoved, text: "removed " + oq, old: ov})
+			case !ook && nok:
+				d.add(false, obj, part, message{kind: TagChanged, text: "added " + nq, new: nv})
+			case ov != nv:
+				d.add(false, obj, part, message{
+					kind: TagChanged,
+					text: fmt.Sprintf("changed from %s to %s", oq, nq),
+					old:  ov,
+					new:  nv,
+				})
+			}
+		}
+	}
+}
+
+// exportedFieldTags returns the tags of the immediate exported fields of s.
+func exportedFieldTags(s *types.Struct) map[string]reflect.StructTag {
+	m := map[string]reflect.StructTag{}
+	for i := 0; i < s.NumFields(); i++ {
+		if f := s.Field(i); f.Exported() {
+			m[f.Name()] = reflect.StructTag(s.Tag(i))
+		}
+	}
+	return m
+}
+
+// checkFieldOrder reports a change in the relative order of the fields common
+// to old and new, if clients can write unkeyed literals of both.
+func (d *differ) checkFieldOrder(obj types.Object, old, new *types.Struct) {
+	oldNames, ok1 := allExportedFieldNames(old)
+	newNames, ok2 := allExportedFieldNames(new)
+	if !ok1 || !ok2 {
+		return
+	}
+	oldOrder := commonNames(oldNames, newNames)
+	newOrder := commonNames(newNames, oldNames)
+	if !reflect.DeepEqual(oldOrder, newOrder) {
+		d.add(false, obj, ", field order", changedMessage(FieldsReordered,
+			strings.Join(oldOrder, ", "), strings.Join(newOrder, ", ")))
+	}
+}
+
+// allExportedFieldNames returns the names of the fields of s in order. It
+// reports false if any field is unexported.
+func allExportedFieldNames(s *types.Struct) ([]string, bool) {
+	var names []string
+	for i := 0; i < s.NumFields(); i++ {
+		f := s.Field(i)
+		if !f.Exported() {
+			return nil, false
+		}
+		names = append(names, f.Name())
+	}
+	return names, true
+}
+
+// commonNames returns the elements of xs that are also in ys, in order.
+func commonNames(xs, ys []string) []string {
+	in := map[string]bool{}
+	for _, y := range ys {
+		in[y] = true
+	}
+	var common []string
+	for _, x := range xs {
+		if in[x] {
+			common = append(common, x)
+		}
+	}
+	return common
+}
+
+// checkPromotion reports exported methods of a defined struct type that are
+// in the method sets of both old and new, but are selected through different
+// embedded fields.
+func (d *differ) checkPromotion(otn *types.TypeName, old, new types.Type) {
+	oldSels := methodSelectors(otn.Name(), old)
+	newSels := methodSelectors(otn.Name(), new)
+	for name, osel := range oldSels {
+		if nsel, ok := newSels[name]; ok && osel != nsel {
+			d.add(true, otn, ", method "+name, changedMessage(PromotionChanged, osel, nsel))
+		}
+	}
+}
+
+// methodSelectors returns, for each exported method in the method set of *t,
+// the selector expression that the method resolves to, starting from
+// typeName. For example, if T embeds E, which declares M, the selector of M
+// is "T.E.M".
+func methodSelectors(typeName string, t types.Type) map[string]string {
+	m := map[string]string{}
+	ms := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < ms.Len(); i++ {
+		sel := ms.At(i)
+		if !sel.Obj().Exported() {
+			continue
+		}
+		path := []string{typeName}
+		cur := t
+		index := sel.Index()
+		for _, fi := range index[:len(index)-1] {
+			s, ok := cur.Underlying().(*types.Struct)
+			if !ok {
+				break
+			}
+			f := s.Field(fi)
+			path = append(path, f.Name())
+			cur = f.Type()
+			if p, ok := cur.Underlying().(*types.Pointer); ok {
+				cur = p.Elem()
+			}
+		}
+		path = append(path, sel.Obj().Name())
+		m[sel.Obj().Name()] = strings.Join(path, ".")
+	}
+	return m
+}
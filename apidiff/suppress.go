@@ -0,0 +1,170 @@
+package apidiff
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Suppression acknowledges a change that should no longer be reported,
+// such as a deliberate break in an experimental package.
+//
+// Suppressions are usually read from a file with ReadSuppressions. Each
+// non-blank line of the file that does not begin with '#' holds one
+// suppression, in the form
+//
+//	path kind [expires=YYYY-MM-DD] [justification]
+//
+// where path is the object path of the change (see Change.ObjectPath) and
+// kind is its ChangeKind. A path containing spaces must be written as a Go
+// string literal. For example:
+//
+//	# The experimental API was removed before v1.
+//	example.com/m/exp.Client removed expires=2021-06-30 replaced by package client
+//	example.com/m/exp.Options.Debug type-changed
+type Suppression struct {
+	Path string
+	Kind ChangeKind
+	// Expires is the last day on which the suppression applies.
+	// It is the zero time if the suppression never expires.
+	Expires       time.Time
+	Justification string `json:",omitempty"`
+	// Pos is the position of the suppression in its file, as "file:line".
+	Pos string `json:",omitempty"`
+}
+
+// A SuppressedChange is a change that matched a suppression.
+type SuppressedChange struct {
+	Change
+	Suppression Suppression
+}
+
+// A StaleSuppression is a suppression that did not suppress any change.
+type StaleSuppression struct {
+	Suppression
+	// Reason is "expired" if the suppression has expired, or "unused" if it
+	// did not match any change.
+	Reason string
+}
+
+// ObjectPath returns the path by which a suppression refers to c: its
+// package path, followed by its object and part, if any, each preceded by
+// a dot.
+func (c Change) ObjectPath() string {
+	p := c.Package
+	if c.Object != "" {
+		p += "." + c.Object
+	}
+	if c.Part != "" {
+		p += "." + c.Part
+	}
+	return p
+}
+
+// ReadSuppressions reads a file of suppressions.
+func ReadSuppressions(filename string) ([]Suppression, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSuppressions(filename, data)
+}
+
+// ParseSuppressions parses suppressions in the format described by
+// Suppression. The filename is used in error messages and positions.
+func ParseSuppressions(filename string, data []byte) ([]Suppression, error) {
+	var sups []Suppression
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		pos := fmt.Sprintf("%s:%d", filename, line)
+		sup, err := parseSuppression(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", pos, err)
+		}
+		sup.Pos = pos
+		sups = append(sups, sup)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return sups, nil
+}
+
+func parseSuppression(text string) (Suppression, error) {
+	var sup Suppression
+	if strings.HasPrefix(text, `"`) {
+		q, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return sup, fmt.Errorf("malformed path: %v", err)
+		}
+		sup.Path, _ = strconv.Unquote(q)
+		text = text[len(q):]
+	} else {
+		i := strings.IndexAny(text, " \t")
+		if i < 0 {
+			i = len(text)
+		}
+		sup.Path, text = text[:i], text[i:]
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return sup, fmt.Errorf("missing change kind")
+	}
+	sup.Kind = ChangeKind(fields[0])
+	fields = fields[1:]
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "expires=") {
+		t, err := time.Parse("2006-01-02", strings.TrimPrefix(fields[0], "expires="))
+		if err != nil {
+			return sup, fmt.Errorf("malformed expiry: %v", err)
+		}
+		sup.Expires = t
+		fields = fields[1:]
+	}
+	sup.Justification = strings.Join(fields, " ")
+	return sup, nil
+}
+
+// Suppress returns a copy of r in which the changes matched by an unexpired
+// suppression are moved from Changes to Suppressed. A suppression matches a
+// change with the same object path and kind. Suppressions that have expired
+// as of now, or that match no change, are listed in StaleSuppressions.
+func (r Report) Suppress(sups []Suppression, now time.Time) Report {
+	used := make([]bool, len(sups))
+	expired := func(s Suppression) bool {
+		return !s.Expires.IsZero() && !now.Before(s.Expires.AddDate(0, 0, 1))
+	}
+	nr := Report{
+		Hints:             r.Hints,
+		Suppressed:        append([]SuppressedChange(nil), r.Suppressed...),
+		StaleSuppressions: append([]StaleSuppression(nil), r.StaleSuppressions...),
+	}
+outer:
+	for _, c := range r.Changes {
+		path := c.ObjectPath()
+		for i, s := range sups {
+			if s.Path == path && s.Kind == c.Kind && !expired(s) {
+				used[i] = true
+				nr.Suppressed = append(nr.Suppressed, SuppressedChange{Change: c, Suppression: s})
+				continue outer
+			}
+		}
+		nr.Changes = append(nr.Changes, c)
+	}
+	for i, s := range sups {
+		switch {
+		case expired(s):
+			nr.StaleSuppressions = append(nr.StaleSuppressions, StaleSuppression{s, "expired"})
+		case !used[i]:
+			nr.StaleSuppressions = append(nr.StaleSuppressions, StaleSuppression{s, "unused"})
+		}
+	}
+	return nr
+}
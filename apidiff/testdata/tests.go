@@ -160,7 +160,7 @@ const (
 
 // new
 const (
-	// i Cr1: value changed from 1 to -1
+	// i Cr1: value changed from 1 to -1; no longer representable by uint8, uint16, uint32, uint64
 	Cr1 = -1
 	// i Cr2: value changed from "2" to "3"
 	Cr2 = "3"
@@ -170,6 +170,27 @@ const (
 	Cr4 = complex(4.1, 0)
 )
 
+// representability
+// old
+const (
+	Cr5       = 255
+	Cr6       = 1 << 31
+	Cr7 int64 = 7
+	Cr8       = 1e38
+)
+
+// new
+const (
+	// i Cr5: value changed from 255 to 256; no longer representable by uint8
+	Cr5 = 256
+	// i Cr6: value changed from 2147483648 to 4294967296; no longer representable by uint32
+	Cr6 = 1 << 32
+	// i Cr7: value changed from 7 to -7; no longer representable by uint8, uint16, uint32, uint64
+	Cr7 int64 = -7
+	// i Cr8: value changed from 1e+38 to 1e+39; no longer representable by float32, complex64
+	Cr8 = 1e39
+)
+
 //////////////// Variables
 
 //// simple type changes
@@ -836,6 +857,44 @@ type WS2 int
 func (WS2) M2() {}
 func (WS2) m2() {}
 
+// old
+type WI3 interface {
+	M3()
+	m3()
+}
+
+type WS3 int
+
+func (*WS3) M3() {}
+func (*WS3) m3() {}
+
+type WS4 int
+
+func (WS4) M1() {}
+func (WS4) m1() {}
+func (WS4) M2() {}
+func (WS4) m2() {}
+
+// new
+type WI3 interface {
+	M3()
+	m3()
+	// i WS3: no longer implements WI3 (as *WS3)
+	m4()
+}
+
+type WS3 int
+
+func (*WS3) M3() {}
+func (*WS3) m3() {}
+
+// i WS4: no longer implements I1, WI1, WI2
+type WS4 int
+
+func (WS4) M1() {}
+func (WS4) M2() {}
+func (WS4) m2() {}
+
 //////////////// Miscellany
 
 // This verifies that the code works even through
@@ -922,3 +981,125 @@ type j4 = k4
 // i Vj4: changed from k4 to j4
 // e.g. p.Vj4 = p.Vk4
 type j4 k4
+
+//////////////// Generics
+
+//// Adding or removing type parameters is incompatible.
+// old
+func G1[T any](T) {}
+
+// new
+// i G1: type parameters changed from [T any] to [T any, U any]
+func G1[T, U any](T) {}
+
+// old
+func G2(int) {}
+
+// new
+// i G2: type parameters changed from [] to [T any]
+func G2[T any](T) {}
+
+//// Loosening a constraint is compatible.
+// old
+func G3[T comparable](T) {}
+
+// new
+// c G3, type parameter T: constraint loosened from comparable to any
+func G3[T any](T) {}
+
+// old
+func G4[T ~int | ~string](T) {}
+
+// new
+// c G4, type parameter T: constraint loosened from ~int | ~string to ~int | ~string | ~float64
+func G4[T ~int | ~string | ~float64](T) {}
+
+// old
+func G5[T interface{ String() string }](T) {}
+
+// new
+// c G5, type parameter T: constraint loosened from interface{String() string} to any
+func G5[T any](T) {}
+
+//// Tightening a constraint is incompatible.
+// old
+func G6[T any](T) {}
+
+// new
+// i G6, type parameter T: constraint tightened from any to comparable
+func G6[T comparable](T) {}
+
+// old
+func G7[T ~int | ~string](T) {}
+
+// new
+// i G7, type parameter T: constraint tightened from ~int | ~string to int
+func G7[T int](T) {}
+
+//// So is any other change.
+// old
+func G8[T ~int](T) {}
+
+// new
+// i G8, type parameter T: constraint changed from ~int to ~string
+func G8[T ~string](T) {}
+
+//// Signatures of generic functions are compared as usual.
+// old
+func G9[T any](T) {}
+
+// new
+// i G9: changed from func[T any](T) to func[T any](T) int
+func G9[T any](T) int { return 0 }
+
+//// Generic types.
+// old
+type GT1[T any] struct{ F T }
+
+// new
+// i GT1: type parameters changed from [T any] to [K comparable, V any]
+type GT1[K comparable, V any] struct{ F K }
+
+// old
+type GT2[T comparable] struct{ F T }
+
+// new
+// c GT2, type parameter T: constraint loosened from comparable to any
+// c GT2.G: added
+type GT2[T any] struct{ F, G T }
+
+// old
+type GT3[T any] struct{}
+
+func (GT3[T]) M(T) {}
+
+// new
+type GT3[T any] struct{}
+
+// i GT3[T].M: changed from func(T) to func(T, int)
+func (GT3[T]) M(T, int) {}
+
+//// Instantiations of a generic type correspond if their type arguments do.
+// both
+type GT4[T any] struct{ F T }
+
+// old
+var GV1 GT4[int]
+var GV2 GT4[string]
+
+// new
+var GV1 GT4[int] // OK
+
+// i GV2: changed from GT4[string] to GT4[bool]
+var GV2 GT4[bool]
+
+//// The type terms of a constraint interface must correspond.
+// old
+type Number interface{ ~int | ~float64 }
+
+// new
+// i Number: changed from interface{~int | ~float64} to interface{~int}
+type Number interface{ ~int }
+
+// both
+func G10[T Number](T) {} // OK: the constraints correspond by name
@@ -0,0 +1,259 @@
+package apidiff
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// Type parameter compatibility:
+//
+// Adding or removing a type parameter of a generic function or type is an
+// incompatible change, since it breaks explicit instantiations like F[int].
+// For the same reason, making a function or type generic, or no longer
+// generic, is incompatible.
+//
+// Changing the constraint of a type parameter is compatible if the new
+// constraint is looser: every type argument that satisfied the old constraint
+// satisfies the new. Any other change, in particular tightening, may make an
+// existing instantiation invalid and so is incompatible. We only recognize a
+// looser constraint when it is evident from the methods, type terms and
+// comparability of the constraint interfaces; other changes are reported as
+// incompatible.
+//
+// Type parameters correspond by position. An exposed constraint interface is
+// compared like any other interface, except that its type terms must also
+// correspond: both adding and removing terms can break client code that uses
+// it as a constraint.
+
+// checkTypeParams compares the type parameter lists of a generic function or
+// type, reporting changes to obj. It reports whether the lists have the same
+// length; if they do not, no other comparison of the two is meaningful.
+func (d *differ) checkTypeParams(obj types.Object, old, new *types.TypeParamList) bool {
+	if old.Len() != new.Len() {
+		olds := typeParamsString(old, d.old)
+		news := typeParamsString(new, d.new)
+		d.add(false, obj, "", message{
+			kind: TypeParamsChanged,
+			text: fmt.Sprintf("type parameters changed from %s to %s", olds, news),
+			old:  olds,
+			new:  news,
+		})
+		return false
+	}
+	for i := 0; i < old.Len(); i++ {
+		otp, ntp := old.At(i), new.At(i)
+		oc, nc := otp.Constraint(), ntp.Constraint()
+		if d.correspond(oc, nc) {
+			continue
+		}
+		part := ", type parameter " + otp.Obj().Name()
+		olds := types.TypeString(oc, types.RelativeTo(d.old))
+		news := types.TypeString(nc, types.RelativeTo(d.new))
+		switch {
+		case d.constraintImplies(oc, nc):
+			d.add(true, obj, part, message{
+				kind: ConstraintLoosened,
+				text: fmt.Sprintf("constraint loosened from %s to %s", olds, news),
+				old:  olds,
+				new:  news,
+			})
+		case d.constraintImplies(nc, oc):
+			d.add(false, obj, part, message{
+				kind: ConstraintTightened,
+				text: fmt.Sprintf("constraint tightened from %s to %s", olds, news),
+				old:  olds,
+				new:  news,
+			})
+		default:
+			d.add(false, obj, part, message{
+				kind: ConstraintChanged,
+				text: fmt.Sprintf("constraint changed from %s to %s", olds, news),
+				old:  olds,
+				new:  news,
+			})
+		}
+	}
+	return true
+}
+
+// constraintImplies reports whether every type that satisfies the constraint
+// x also evidently satisfies y. When x is the new constraint and y the old,
+// defined types in them are matched by name only.
+func (d *differ) constraintImplies(x, y types.Type) bool {
+	xi, ok1 := x.Underlying().(*types.Interface)
+	yi, ok2 := y.Underlying().(*types.Interface)
+	if !ok1 || !ok2 {
+		return false
+	}
+	xs, xok := typeSetOf(xi)
+	ys, yok := typeSetOf(yi)
+	if !xok || !yok {
+		return false
+	}
+	// Every method required by y must be required by x.
+	xms := map[string]*types.Func{}
+	for _, m := range d.sortedMethods(xi) {
+		xms[d.methodID(m)] = m
+	}
+	for _, ym := range d.sortedMethods(yi) {
+		xm := xms[d.methodID(ym)]
+		if xm == nil || !d.correspondQuietly(xm.Type(), ym.Type()) {
+			return false
+		}
+	}
+	// If y admits only comparable types, so must x.
+	if yi.IsComparable() && !xi.IsComparable() {
+		return false
+	}
+	// If y restricts the type set with terms, each term of x must be
+	// covered by a term of y.
+	if ys.terms == nil {
+		return true
+	}
+	if xs.terms == nil {
+		return false
+	}
+	for _, xt := range xs.terms {
+		covered := false
+		for _, yt := range ys.terms {
+			if d.termCovers(yt, xt) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// termCovers reports whether every type in the type set of term x is in the
+// type set of term y.
+func (d *differ) termCovers(y, x *types.Term) bool {
+	if d.correspondQuietly(x.Type(), y.Type()) {
+		return y.Tilde() || !x.Tilde()
+	}
+	// A term ~U covers a defined type whose underlying type is U.
+	return y.Tilde() && !x.Tilde() && d.correspondQuietly(x.Type().Underlying(), y.Type())
+}
+
+// correspondQuietly is like correspond, but does not establish any new
+// correspondences. It is used for speculative comparisons.
+func (d *differ) correspondQuietly(old, new types.Type) bool {
+	saved := make(map[*types.TypeName]types.Type, len(d.correspondMap))
+	for k, v := range d.correspondMap {
+		saved[k] = v
+	}
+	incompatibles, compatibles := d.incompatibles, d.compatibles
+	d.incompatibles, d.compatibles = messageSet{}, messageSet{}
+	ok := d.correspond(old, new)
+	d.correspondMap = saved
+	d.incompatibles, d.compatibles = incompatibles, compatibles
+	return ok
+}
+
+// A typeSet describes the restriction an interface places on its type set
+// with type terms.
+type typeSet struct {
+	// terms is the union of type terms the type must belong to, or nil if
+	// there is no such restriction.
+	terms []*types.Term
+}
+
+// typeSetOf returns the type set restrictions of iface. It reports false if
+// the restrictions are too complicated to describe, such as an intersection
+// of several unions.
+func typeSetOf(iface *types.Interface) (typeSet, bool) {
+	var ts typeSet
+	for i := 0; i < iface.NumEmbeddeds(); i++ {
+		var terms []*types.Term
+		switch e := types.Unalias(iface.EmbeddedType(i)).(type) {
+		case *types.Union:
+			for j := 0; j < e.Len(); j++ {
+				terms = append(terms, e.Term(j))
+			}
+		case *types.Named:
+			if ei, ok := e.Underlying().(*types.Interface); ok {
+				es, ok := typeSetOf(ei)
+				if !ok {
+					return typeSet{}, false
+				}
+				terms = es.terms
+			} else {
+				terms = []*types.Term{types.NewTerm(false, e)}
+			}
+		case *types.Interface:
+			es, ok := typeSetOf(e)
+			if !ok {
+				return typeSet{}, false
+			}
+			terms = es.terms
+		default:
+			terms = []*types.Term{types.NewTerm(false, e)}
+		}
+		if terms == nil {
+			continue
+		}
+		if ts.terms != nil {
+			return typeSet{}, false
+		}
+		ts.terms = terms
+	}
+	return ts, true
+}
+
+// corrTypeSets reports whether the type terms and comparability of two
+// interfaces correspond.
+func (d *differ) corrTypeSets(old, new *types.Interface, p *ifacePair) bool {
+	ots, ook := typeSetOf(old)
+	nts, nok := typeSetOf(new)
+	if !ook || !nok {
+		return types.Identical(old, new)
+	}
+	if old.IsComparable() != new.IsComparable() || len(ots.terms) != len(nts.terms) {
+		return false
+	}
+	// Terms must correspond pairwise, in order.
+	ok := true
+	for i, ot := range ots.terms {
+		nt := nts.terms[i]
+		if ot.Tilde() != nt.Tilde() || !d.corr(ot.Type(), nt.Type(), p) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// corrTypeArgs reports whether the type arguments of two instantiated types
+// correspond. Like corr, it compares as many arguments as it can.
+func (d *differ) corrTypeArgs(old, new *types.TypeList, p *ifacePair) bool {
+	ok := old.Len() == new.Len()
+	for i := 0; i < old.Len() && i < new.Len(); i++ {
+		if !d.corr(old.At(i), new.At(i), p) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// typeParamsString formats a type parameter list, as in "[K comparable, V any]".
+func typeParamsString(tps *types.TypeParamList, pkg *types.Package) string {
+	if tps.Len() == 0 {
+		return "[]"
+	}
+	var b strings.Builder
+	b.WriteByte('[')
+	for i := 0; i < tps.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		tp := tps.At(i)
+		b.WriteString(tp.Obj().Name())
+		b.WriteByte(' ')
+		b.WriteString(types.TypeString(tp.Constraint(), types.RelativeTo(pkg)))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
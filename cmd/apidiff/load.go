@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/tools/go/packages"
+)
+
+// A version is one side of a comparison: the packages loaded from a single
+// command-line argument.
+type version struct {
+	module *apidiff.Module
+	fset   *token.FileSet
+	// pkgs holds the loaded packages, if the argument was not a file of
+	// export data.
+	pkgs []*packages.Package
+}
+
+// checkouts holds the directories into which arguments of the form
+// PATTERN@REV or PATTERN@VERSION have been checked out, so that they are
+// checked out only once when loaded for several platforms.
+var checkouts = map[string]string{}
+
+// cleanups are run before the program exits, to remove temporary
+// directories and git worktrees. They are guarded by cleanupMu, since an
+// interrupt runs them from another goroutine.
+var (
+	cleanupMu sync.Mutex
+	cleanups  []func()
+)
+
+func addCleanup(f func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	cleanups = append(cleanups, f)
+}
+
+func runCleanups() {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+	cleanups = nil
+}
+
+// cleanupOnInterrupt arranges for the cleanups to run when the program is
+// interrupted, so that no temporary worktrees are left behind.
+func cleanupOnInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		runCleanups()
+		os.Exit(1)
+	}()
+}
+
+// mustLoadVersion loads the packages described by arg, which may be
+//
+//   - an API snapshot file written with -snapshot,
+//   - a file of export data written with -w,
+//   - a package path or pattern, loaded from the current directory,
+//   - PATTERN@REV, where PATTERN is a relative pattern like ./... or a
+//     pattern within the main module, and REV is a git revision of the
+//     repository containing the current directory, or
+//   - PATTERN@VERSION, for a pattern in any other module, loaded from the
+//     module cache. The module is the one with the longest path that
+//     contains the pattern and has the version. If the pattern is the module
+//     path itself, all packages of the module are loaded.
+//
+// A version with a single package is a module of that package alone, so that
+// any two packages may be compared.
+//
+// If plat is not nil, packages are loaded as built for that platform.
+// Files of export data and snapshots describe a single platform, so they
+// cannot be loaded for another.
+func mustLoadVersion(arg string, mode packages.LoadMode, plat *platform) *version {
+	if fileInfo, err := os.Stat(arg); err == nil && fileInfo.Mode().IsRegular() {
+		if plat != nil {
+			die("%s: files cannot be loaded for a platform", arg)
+		}
+		fset := token.NewFileSet()
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			die("%v", err)
+		}
+		if bytes.HasPrefix(data, []byte(apidiff.SnapshotHeader)) {
+			m, err := apidiff.ParseSnapshot(fset, arg, data)
+			if err != nil {
+				die("reading snapshot: %v", err)
+			}
+			return &version{module: m, fset: fset}
+		}
+		pkg, err := readExportData(arg, fset)
+		if err != nil {
+			die("reading export data from %s: %v", arg, err)
+		}
+		return &version{
+			module: &apidiff.Module{Path: pkg.Path(), Packages: []*types.Package{pkg}},
+			fset:   fset,
+		}
+	}
+
+	pattern, rev := arg, ""
+	if i := strings.LastIndex(arg, "@"); i >= 0 {
+		pattern, rev = arg[:i], arg[i+1:]
+	}
+	dir, modPath := "", ""
+	var env, buildFlags []string
+	if rev != "" {
+		if !isMainModulePattern(pattern) {
+			var err error
+			if modPath, err = resolveModule(pattern, rev); err != nil {
+				die("loading %s: %v", arg, err)
+			}
+		}
+		dir = checkouts[arg]
+		if dir == "" {
+			var err error
+			if modPath == "" {
+				dir, err = gitWorktree(rev)
+			} else {
+				dir, err = moduleCopy(modPath, rev)
+			}
+			if err != nil {
+				die("loading %s: %v", arg, err)
+			}
+			checkouts[arg] = dir
+		}
+		if modPath != "" {
+			pattern = modulePattern(pattern, modPath)
+		}
+		// The go.sum file of an old revision may be incomplete. A later
+		// -mod flag overrides an earlier one in the user's GOFLAGS.
+		env = append(os.Environ(), "GOFLAGS="+strings.TrimSpace(os.Getenv("GOFLAGS")+" -mod=mod"))
+	}
+	if plat != nil {
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(env, "GOOS="+plat.goos, "GOARCH="+plat.goarch)
+		if len(plat.tags) > 0 {
+			buildFlags = []string{"-tags=" + strings.Join(plat.tags, ",")}
+		}
+	}
+	pkgs, err := loadPackages(pattern, mode, dir, env, buildFlags)
+	if err != nil {
+		die("loading %s: %v", arg, err)
+	}
+	v := &version{module: &apidiff.Module{}, pkgs: pkgs, fset: pkgs[0].Fset}
+	for _, pkg := range pkgs {
+		v.module.Packages = append(v.module.Packages, pkg.Types)
+	}
+	switch {
+	case modPath != "":
+		v.module.Path = modPath
+	case len(pkgs) == 1:
+		v.module.Path = pkgs[0].PkgPath
+	default:
+		if v.module.Path, err = mainModulePath(dir); err != nil {
+			die("loading %s: %v", arg, err)
+		}
+	}
+	return v
+}
+
+// isMainModulePattern reports whether pattern refers to packages of the main
+// module of the current directory.
+func isMainModulePattern(pattern string) bool {
+	if pattern == "." || strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../") || filepath.IsAbs(pattern) {
+		return true
+	}
+	modPath, err := mainModulePath("")
+	if err != nil {
+		return false
+	}
+	pattern = strings.TrimSuffix(pattern, "/...")
+	return pattern == modPath || strings.HasPrefix(pattern, modPath+"/")
+}
+
+// mainModulePath returns the path of the main module of dir.
+func mainModulePath(dir string) (string, error) {
+	out, err := runCmd(dir, nil, "go", "list", "-m")
+	if err != nil {
+		return "", err
+	}
+	// In workspace mode, there may be several main modules.
+	return strings.SplitN(strings.TrimSpace(out), "\n", 2)[0], nil
+}
+
+// resolveModule returns the path of the module that provides the packages
+// matching pattern at version: the longest prefix of the pattern's path that
+// is a module with that version, according to "go list -m".
+func resolveModule(pattern, version string) (string, error) {
+	var firstErr error
+	for p := strings.TrimSuffix(pattern, "/..."); ; {
+		_, err := runCmd("", nil, "go", "list", "-m", p+"@"+version)
+		if err == nil {
+			return p, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			return "", firstErr
+		}
+		p = p[:i]
+	}
+}
+
+// modulePattern returns pattern relative to the root directory of the module
+// modPath that contains it. A pattern that is the module path itself matches
+// all packages of the module.
+func modulePattern(pattern, modPath string) string {
+	m := &apidiff.Module{Path: modPath}
+	rel := m.RelativePath(strings.TrimSuffix(pattern, "/..."))
+	if rel == "" {
+		return "./..."
+	}
+	if strings.HasSuffix(pattern, "/...") {
+		return "./" + rel + "/..."
+	}
+	return "./" + rel
+}
+
+// gitWorktree checks out rev of the git repository containing the current
+// directory in a temporary worktree. It returns the directory of the worktree
+// that corresponds to the current directory.
+func gitWorktree(rev string) (string, error) {
+	if _, err := runCmd("", nil, "git", "rev-parse", "--verify", "--quiet", rev+"^{commit}"); err != nil {
+		return "", fmt.Errorf("unknown git revision %q", rev)
+	}
+	prefix, err := runCmd("", nil, "git", "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir("", "apidiff-")
+	if err != nil {
+		return "", err
+	}
+	// git worktree add requires that the directory not exist.
+	wt := filepath.Join(tmp, "worktree")
+	if _, err := runCmd("", nil, "git", "worktree", "add", "--detach", wt, rev); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	addCleanup(func() {
+		runCmd("", nil, "git", "worktree", "remove", "--force", wt)
+		os.RemoveAll(tmp)
+	})
+	return filepath.Join(wt, strings.TrimSpace(prefix)), nil
+}
+
+// moduleCopy copies version of the module modPath from the module cache to a
+// temporary directory and returns the directory. The module is downloaded
+// first if necessary and allowed by GOPROXY.
+func moduleCopy(modPath, version string) (string, error) {
+	out, err := runCmd("", nil, "go", "mod", "download", "-json", modPath+"@"+version)
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Dir   string
+		Error string
+	}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return "", err
+	}
+	if info.Error != "" {
+		return "", fmt.Errorf("%s", info.Error)
+	}
+	tmp, err := ioutil.TempDir("", "apidiff-")
+	if err != nil {
+		return "", err
+	}
+	addCleanup(func() { os.RemoveAll(tmp) })
+	// Files in the module cache are read-only, but loading the packages may
+	// need to update go.mod and go.sum.
+	if err := copyDir(tmp, info.Dir); err != nil {
+		return "", err
+	}
+	return tmp, nil
+}
+
+// copyDir copies the files in the tree rooted at src to dst, which must
+// exist. The copies are writable.
+func copyDir(dst, src string) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
+
+// runCmd runs a command in dir with the given environment and returns its
+// standard output. The error includes the standard error output.
+func runCmd(dir string, env []string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return stdout.String(), nil
+}
+
+// loadPackages loads the packages matching pattern in dir with the given
+// environment and build flags.
+func loadPackages(pattern string, mode packages.LoadMode, dir string, env, buildFlags []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{Mode: mode, Dir: dir, Env: env, BuildFlags: buildFlags}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("found no packages for %s", pattern)
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.Errors) > 0 {
+			return nil, pkg.Errors[0]
+		}
+		if pkg.IllTyped {
+			return nil, fmt.Errorf("%s: could not type-check package", pkg.PkgPath)
+		}
+	}
+	return pkgs, nil
+}
+
+// syntaxHints returns hints for each package of new that has a package with
+// the same relative path in old. Both versions must have been loaded with
+// syntax.
+func syntaxHints(old, new *version) []apidiff.Hint {
+	oldByRel := map[string]*packages.Package{}
+	for _, pkg := range old.pkgs {
+		oldByRel[old.module.RelativePath(pkg.PkgPath)] = pkg
+	}
+	var hints []apidiff.Hint
+	for _, npkg := range new.pkgs {
+		opkg := oldByRel[new.module.RelativePath(npkg.PkgPath)]
+		if opkg == nil {
+			continue
+		}
+		hints = append(hints, apidiff.Hints(
+			&apidiff.PackageSyntax{Path: opkg.PkgPath, Fset: opkg.Fset, Files: opkg.Syntax},
+			&apidiff.PackageSyntax{Path: npkg.PkgPath, Fset: npkg.Fset, Files: npkg.Syntax})...)
+	}
+	return hints
+}
@@ -8,6 +8,7 @@ import (
 	"go/token"
 	"go/types"
 	"os"
+	"time"
 
 	"golang.org/x/exp/apidiff"
 	"golang.org/x/tools/go/gcexportdata"
@@ -16,7 +17,13 @@ import (
 
 var (
 	exportDataOutfile = flag.String("w", "", "file for export data")
+	snapshotOutfile   = flag.String("snapshot", "", "file for an API snapshot")
 	incompatibleOnly  = flag.Bool("incompatible", false, "display only incompatible changes")
+	jsonOutput        = flag.Bool("json", false, "write the report as JSON (same as -format=json)")
+	format            = flag.String("format", "text", "report format: text, json, markdown or html")
+	suppressFile      = flag.String("suppress", "", "file of suppressions for acknowledged changes")
+	hints             = flag.Bool("hints", false, "report hints about changes in behavior (not for export data files)")
+	platformList      = flag.String("platforms", "", "space-separated list of platforms to compare, as GOOS/GOARCH[,tag...]")
 )
 
 func main() {
@@ -25,7 +32,24 @@ func main() {
 		fmt.Fprintf(w, "usage:\n")
 		fmt.Fprintf(w, "apidiff OLD NEW\n")
 		fmt.Fprintf(w, "   compares OLD and NEW package APIs\n")
-		fmt.Fprintf(w, "   where OLD and NEW are either import paths or files of export data\n")
+		fmt.Fprintf(w, "   where OLD and NEW are either import paths, API snapshot files\n")
+		fmt.Fprintf(w, "   or files of export data\n")
+		fmt.Fprintf(w, "   An import path may be a pattern like ./... that matches several\n")
+		fmt.Fprintf(w, "   packages, and may be followed by @REV to load it from the git\n")
+		fmt.Fprintf(w, "   revision REV, checked out in a temporary worktree. Packages outside\n")
+		fmt.Fprintf(w, "   the main module are given as MODULE@VERSION, and loaded from the\n")
+		fmt.Fprintf(w, "   module cache, downloading them if GOPROXY allows.\n")
+		fmt.Fprintf(w, "   For example:\n")
+		fmt.Fprintf(w, "      apidiff ./...@v1.2.0 ./...\n")
+		fmt.Fprintf(w, "      apidiff example.com/mod@v1.2.0 example.com/mod@v1.3.0\n")
+		fmt.Fprintf(w, "   With -platforms, the packages are compared as built for each of the\n")
+		fmt.Fprintf(w, "   listed platforms, and changes that occur on only some of them are\n")
+		fmt.Fprintf(w, "   reported with those platforms. For example:\n")
+		fmt.Fprintf(w, "      apidiff -platforms='linux/amd64 windows/amd64 linux/amd64,purego' ./...@v1.2.0 ./...\n")
+		fmt.Fprintf(w, "apidiff -snapshot FILE PACKAGES\n")
+		fmt.Fprintf(w, "   writes a textual snapshot of the API of PACKAGES, which are given\n")
+		fmt.Fprintf(w, "   like OLD and NEW above, to FILE. A snapshot is independent of the\n")
+		fmt.Fprintf(w, "   Go version, and suitable for checking in as an API baseline.\n")
 		fmt.Fprintf(w, "apidiff -w FILE IMPORT_PATH\n")
 		fmt.Fprintf(w, "   writes export data of the package at IMPORT_PATH to FILE\n")
 		fmt.Fprintf(w, "   NOTE: In a GOPATH-less environment, this option consults the\n")
@@ -38,7 +62,17 @@ func main() {
 	}
 
 	flag.Parse()
-	if *exportDataOutfile != "" {
+	cleanupOnInterrupt()
+	if *snapshotOutfile != "" {
+		if len(flag.Args()) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		v := mustLoadVersion(flag.Arg(0), packages.LoadTypes, nil)
+		if err := writeSnapshot(v.module, *snapshotOutfile); err != nil {
+			die("writing snapshot: %v", err)
+		}
+	} else if *exportDataOutfile != "" {
 		if len(flag.Args()) != 1 {
 			flag.Usage()
 			os.Exit(2)
@@ -52,59 +86,107 @@ func main() {
 			flag.Usage()
 			os.Exit(2)
 		}
-		oldpkg := mustLoadOrRead(flag.Arg(0))
-		newpkg := mustLoadOrRead(flag.Arg(1))
-
-		report := apidiff.Changes(oldpkg, newpkg)
-		var err error
-		if *incompatibleOnly {
-			err = report.TextIncompatible(os.Stdout, false)
+		mode := packages.LoadTypes
+		if *hints {
+			mode = packages.LoadSyntax
+		}
+		plats, err := parsePlatforms(*platformList)
+		if err != nil {
+			die("%v", err)
+		}
+		var report apidiff.Report
+		if plats == nil {
+			report = compare(flag.Arg(0), flag.Arg(1), mode, nil)
 		} else {
-			err = report.Text(os.Stdout)
+			var reports []apidiff.PlatformReport
+			for _, p := range plats {
+				reports = append(reports, apidiff.PlatformReport{
+					Platform: p.String(),
+					Report:   compare(flag.Arg(0), flag.Arg(1), mode, p),
+				})
+			}
+			report = apidiff.MergePlatforms(reports)
+		}
+		if *suppressFile != "" {
+			sups, err := apidiff.ReadSuppressions(*suppressFile)
+			if err != nil {
+				die("reading suppressions: %v", err)
+			}
+			report = report.Suppress(sups, time.Now())
+		}
+		if *jsonOutput {
+			*format = "json"
+		}
+		renderer, ok := renderers[*format]
+		if !ok {
+			die("unknown report format %q", *format)
+		}
+		switch {
+		case *incompatibleOnly && *format == "text":
+			err = report.TextIncompatible(os.Stdout, false)
+		case *incompatibleOnly:
+			err = renderer.Render(os.Stdout, incompatibleChanges(report))
+		default:
+			err = renderer.Render(os.Stdout, report)
 		}
 		if err != nil {
 			die("writing report: %v", err)
 		}
 	}
+	runCleanups()
 }
 
-func mustLoadOrRead(importPathOrFile string) *types.Package {
-	fileInfo, err := os.Stat(importPathOrFile)
-	if err == nil && fileInfo.Mode().IsRegular() {
-		pkg, err := readExportData(importPathOrFile)
-		if err != nil {
-			die("reading export data from %s: %v", importPathOrFile, err)
+// compare loads the old and new versions for plat, which may be nil, and
+// reports the changes between them.
+func compare(oldArg, newArg string, mode packages.LoadMode, plat *platform) apidiff.Report {
+	old := mustLoadVersion(oldArg, mode, plat)
+	new := mustLoadVersion(newArg, mode, plat)
+
+	conf := &apidiff.Config{OldFset: old.fset, NewFset: new.fset}
+	report := conf.ModuleChanges(old.module, new.module)
+	if *hints {
+		if old.pkgs == nil || new.pkgs == nil {
+			die("-hints cannot be used with export data files")
 		}
-		return pkg
-	} else {
-		return mustLoadPackage(importPathOrFile).Types
+		report.Hints = syntaxHints(old, new)
 	}
+	return report
 }
 
-func mustLoadPackage(importPath string) *packages.Package {
-	pkg, err := loadPackage(importPath)
-	if err != nil {
-		die("loading %s: %v", importPath, err)
+// renderers maps the values of the -format flag to report renderers.
+var renderers = map[string]apidiff.Renderer{
+	"text":     apidiff.TextRenderer{},
+	"json":     apidiff.JSONRenderer{},
+	"markdown": &apidiff.MarkdownRenderer{},
+	"html":     &apidiff.HTMLRenderer{},
+}
+
+// incompatibleChanges returns a report containing only the incompatible
+// changes of r.
+func incompatibleChanges(r apidiff.Report) apidiff.Report {
+	var ir apidiff.Report
+	for _, c := range r.Changes {
+		if !c.Compatible {
+			ir.Changes = append(ir.Changes, c)
+		}
 	}
-	return pkg
+	ir.Suppressed = r.Suppressed
+	ir.StaleSuppressions = r.StaleSuppressions
+	return ir
 }
 
-func loadPackage(importPath string) (*packages.Package, error) {
-	cfg := &packages.Config{Mode: packages.LoadTypes}
-	pkgs, err := packages.Load(cfg, importPath)
+func mustLoadPackage(importPath string) *packages.Package {
+	pkgs, err := loadPackages(importPath, packages.LoadTypes, "", nil, nil)
 	if err != nil {
-		return nil, err
-	}
-	if len(pkgs) == 0 {
-		return nil, fmt.Errorf("found no packages for import %s", importPath)
+		die("loading %s: %v", importPath, err)
 	}
-	if len(pkgs[0].Errors) > 0 {
-		return nil, pkgs[0].Errors[0]
+	if len(pkgs) > 1 {
+		die("loading %s: matched %d packages, want 1", importPath, len(pkgs))
 	}
-	return pkgs[0], nil
+	return pkgs[0]
 }
 
-func readExportData(filename string) (*types.Package, error) {
+func readExportData(filename string, fset *token.FileSet) (*types.Package, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
@@ -117,7 +199,20 @@ func readExportData(filename string) (*types.Package, error) {
 		return nil, err
 	}
 	pkgPath = pkgPath[:len(pkgPath)-1] // remove delimiter
-	return gcexportdata.Read(r, token.NewFileSet(), m, pkgPath)
+	return gcexportdata.Read(r, fset, m, pkgPath)
+}
+
+func writeSnapshot(m *apidiff.Module, filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err1 := apidiff.WriteSnapshot(f, m)
+	err2 := f.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
 }
 
 func writeExportData(pkg *packages.Package, filename string) error {
@@ -137,6 +232,7 @@ func writeExportData(pkg *packages.Package, filename string) error {
 }
 
 func die(format string, args ...interface{}) {
+	runCleanups()
 	fmt.Fprintf(os.Stderr, format+"\n", args...)
 	os.Exit(1)
 }
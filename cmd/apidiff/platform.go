@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A platform is a configuration for which packages are loaded: a target
+// operating system and architecture, and a set of build tags.
+type platform struct {
+	goos, goarch string
+	tags         []string
+}
+
+// parsePlatforms parses the value of the -platforms flag, a space-separated
+// list of platforms of the form GOOS/GOARCH[,tag...]. It returns nil if the
+// list is empty.
+func parsePlatforms(list string) ([]*platform, error) {
+	var plats []*platform
+	seen := map[string]bool{}
+	for _, f := range strings.Fields(list) {
+		elems := strings.Split(f, ",")
+		osArch := strings.Split(elems[0], "/")
+		if len(osArch) != 2 || osArch[0] == "" || osArch[1] == "" {
+			return nil, fmt.Errorf("invalid platform %q: want GOOS/GOARCH[,tag...]", f)
+		}
+		p := &platform{goos: osArch[0], goarch: osArch[1]}
+		for _, tag := range elems[1:] {
+			if tag == "" {
+				return nil, fmt.Errorf("invalid platform %q: empty build tag", f)
+			}
+			p.tags = append(p.tags, tag)
+		}
+		if seen[p.String()] {
+			return nil, fmt.Errorf("platform %s listed twice", p)
+		}
+		seen[p.String()] = true
+		plats = append(plats, p)
+	}
+	return plats, nil
+}
+
+// String returns p in the form accepted by parsePlatforms.
+func (p *platform) String() string {
+	s := p.goos + "/" + p.goarch
+	if len(p.tags) > 0 {
+		s += "," + strings.Join(p.tags, ",")
+	}
+	return s
+}
@@ -0,0 +1,455 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/packages"
+)
+
+// findDeprecated returns the exported objects of the packages in
+// platformPkgs whose doc comments have a paragraph beginning with
+// "Deprecated: ". The result maps each package path to the set of names of
+// its deprecated objects. Methods, struct fields, and interface methods are
+// named after their types, as in "T.M".
+//
+// Files are parsed again with comments, since packages are loaded without
+// syntax. Files that can't be parsed are ignored; their errors are reported
+// when the packages are loaded.
+func findDeprecated(platformPkgs [][]*packages.Package) map[string]map[string]bool {
+	deprecated := make(map[string]map[string]bool)
+	fset := token.NewFileSet()
+	parsed := make(map[string]bool)
+	for _, pkgs := range platformPkgs {
+		for _, pkg := range pkgs {
+			for _, file := range pkg.GoFiles {
+				if parsed[file] {
+					continue
+				}
+				parsed[file] = true
+				f, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+				if err != nil {
+					continue
+				}
+				for _, name := range deprecatedInFile(f) {
+					if deprecated[pkg.PkgPath] == nil {
+						deprecated[pkg.PkgPath] = make(map[string]bool)
+					}
+					deprecated[pkg.PkgPath][name] = true
+				}
+			}
+		}
+	}
+	return deprecated
+}
+
+// deprecatedInFile returns the names of the deprecated exported objects
+// declared in f, as described in findDeprecated.
+func deprecatedInFile(f *ast.File) []string {
+	var names []string
+	add := func(name string, docs ...*ast.CommentGroup) {
+		for _, doc := range docs {
+			if apidiff.IsDeprecated(doc) {
+				names = append(names, name)
+				return
+			}
+		}
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			name := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				recv, _ := apidiff.ReceiverName(decl.Recv.List[0].Type)
+				if !ast.IsExported(recv) {
+					continue
+				}
+				name = recv + "." + name
+			}
+			add(name, decl.Doc)
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, id := range spec.Names {
+						if id.IsExported() {
+							// A paragraph in the doc comment of a group applies
+							// to all of its specs.
+							add(id.Name, spec.Doc, decl.Doc)
+						}
+					}
+				case *ast.TypeSpec:
+					if !spec.Name.IsExported() {
+						continue
+					}
+					add(spec.Name.Name, spec.Doc, decl.Doc)
+					var fields *ast.FieldList
+					switch t := spec.Type.(type) {
+					case *ast.StructType:
+						fields = t.Fields
+					case *ast.InterfaceType:
+						fields = t.Methods
+					}
+					if fields == nil {
+						continue
+					}
+					for _, field := range fields.List {
+						for _, id := range field.Names {
+							if id.IsExported() {
+								add(spec.Name.Name+"."+id.Name, field.Doc)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadDeprecations sets the deprecated fields of r.base and r.release. It
+// does nothing if there is no base version, since every deprecated API of the
+// release version would be newly deprecated.
+func (r *report) loadDeprecations() {
+	if r.base.version == "none" {
+		return
+	}
+	r.base.deprecated = findDeprecated(r.base.platformPkgs)
+	r.release.deprecated = findDeprecated(r.release.platformPkgs)
+}
+
+// A deprecation describes a deprecated API: an object named as in
+// findDeprecated in the package pkgPath.
+type deprecation struct {
+	pkgPath, name string
+
+	// since is the earliest version of the module in which the API was
+	// deprecated, counting back from the base version through versions with
+	// the same major version in which it stayed deprecated. It is "" for APIs
+	// deprecated in the release version.
+	since string
+
+	// age is the number of minor versions between since and the base
+	// version.
+	age int
+}
+
+func (d deprecation) String() string {
+	return d.pkgPath + "." + d.name
+}
+
+// deprecationReport lists the changes to deprecated APIs between the base
+// and release versions.
+type deprecationReport struct {
+	// added lists the APIs deprecated in the release version but not in the
+	// base version.
+	added []deprecation
+
+	// removed lists the APIs deprecated in the base version that were
+	// removed in the release version.
+	removed []deprecation
+
+	// removable lists the APIs that are still deprecated in a new major
+	// version, and that were deprecated for more than the maximum number of
+	// minor versions before it. They should be removed.
+	removable []deprecation
+}
+
+func (dr *deprecationReport) isEmpty() bool {
+	return len(dr.added) == 0 && len(dr.removed) == 0 && len(dr.removable) == 0
+}
+
+// Text writes the deprecation report as a section of a report.
+func (dr *deprecationReport) Text(buf *bytes.Buffer, releaseMajor string) {
+	if dr.isEmpty() {
+		return
+	}
+	fmt.Fprintln(buf, "Deprecations:")
+	for _, d := range dr.added {
+		fmt.Fprintf(buf, "- %s: newly deprecated\n", d)
+	}
+	for _, d := range dr.removed {
+		fmt.Fprintf(buf, "- %s: removed, deprecated since %s\n", d, d.since)
+	}
+	for _, d := range dr.removable {
+		fmt.Fprintf(buf, "- %s: deprecated since %s; consider removing it in %s\n", d, d.since, releaseMajor)
+	}
+	buf.WriteByte('\n')
+}
+
+// trackDeprecations sets r.deprecations. It finds APIs that were deprecated
+// in the release version, and deprecated APIs that were removed along with
+// the version in which they were deprecated. If the release version has a
+// higher major version than the base version, it also finds APIs that are
+// still deprecated but were deprecated for more than maxAge minor versions,
+// and should be removed.
+//
+// Finding when APIs were deprecated requires downloading earlier versions of
+// the base module, so trackDeprecations only does it when there are removed
+// or removable APIs to report. Deprecated APIs must have been found with
+// loadDeprecations. If there is no base version, nothing is reported.
+//
+// env is the environment for go commands.
+func (r *report) trackDeprecations(maxAge int, env []string) error {
+	dr := &deprecationReport{}
+	r.deprecations = dr
+	if r.base.version == "none" {
+		return nil
+	}
+	newly := r.newlyDeprecated()
+	for pkgPath, names := range newly {
+		for _, name := range names {
+			dr.added = append(dr.added, deprecation{pkgPath: pkgPath, name: name})
+		}
+	}
+	sortDeprecations(dr.added)
+	if r.base.modRoot == "" {
+		return nil
+	}
+
+	releasePkgs := make(map[string]*packages.Package)
+	for _, pkg := range r.release.pkgs {
+		releasePkgs[trimPathPrefix(pkg.PkgPath, r.release.modPath)] = pkg
+	}
+	newMajor := r.release.version != "" && semver.Compare(semver.Major(r.release.version), semver.Major(r.base.version)) > 0
+
+	// Collect the APIs deprecated in the base version that were removed, or
+	// that may be removable in a new major version, and the packages and
+	// names for which to look up when they were deprecated, by package path
+	// relative to the module path.
+	history := make(map[string]map[string]bool)
+	addHistory := func(rel, name string) {
+		if history[rel] == nil {
+			history[rel] = make(map[string]bool)
+		}
+		history[rel][name] = true
+	}
+	for pkgPath, names := range r.base.deprecated {
+		if isInternal(r.base.modPath, pkgPath) {
+			continue
+		}
+		rel := trimPathPrefix(pkgPath, r.base.modPath)
+		releasePkg := releasePkgs[rel]
+		for name := range names {
+			if !apiExists(releasePkg, name) {
+				dr.removed = append(dr.removed, deprecation{pkgPath: pkgPath, name: name})
+				addHistory(rel, name)
+			} else if releasePkgPath := path.Join(r.release.modPath, rel); newMajor && r.release.deprecated[releasePkgPath][name] {
+				dr.removable = append(dr.removable, deprecation{pkgPath: releasePkgPath, name: name})
+				addHistory(rel, name)
+			}
+		}
+	}
+	if len(history) == 0 {
+		return nil
+	}
+
+	// A base version loaded from a directory may not be available from the
+	// proxy, and neither may earlier versions, so only look for them if the
+	// base version was downloaded. Otherwise, APIs are reported as
+	// deprecated since the base version.
+	var since map[string]map[string]string
+	if r.base.zipSum != "" {
+		var err error
+		if since, err = deprecatedSince(r.base.modPath, r.base.version, history, env); err != nil {
+			return err
+		}
+	}
+	setSince := func(ds []deprecation, modPath string) {
+		for i := range ds {
+			ds[i].since = r.base.version
+			if v := since[trimPathPrefix(ds[i].pkgPath, modPath)][ds[i].name]; v != "" {
+				ds[i].since = v
+			}
+			ds[i].age = minorNumber(r.base.version) - minorNumber(ds[i].since)
+		}
+		sortDeprecations(ds)
+	}
+	setSince(dr.removed, r.base.modPath)
+	setSince(dr.removable, r.release.modPath)
+	removable := dr.removable[:0]
+	for _, d := range dr.removable {
+		if d.age > maxAge {
+			removable = append(removable, d)
+		}
+	}
+	dr.removable = removable
+	return nil
+}
+
+func sortDeprecations(ds []deprecation) {
+	sort.Slice(ds, func(i, j int) bool {
+		if ds[i].pkgPath != ds[j].pkgPath {
+			return ds[i].pkgPath < ds[j].pkgPath
+		}
+		return ds[i].name < ds[j].name
+	})
+}
+
+// minorNumber returns the minor version number of the semantic version v.
+func minorNumber(v string) int {
+	mm := semver.MajorMinor(v)
+	n, _ := strconv.Atoi(mm[strings.LastIndex(mm, ".")+1:])
+	return n
+}
+
+// apiExists reports whether pkg has an object named as in findDeprecated.
+// If pkg couldn't be type-checked, apiExists assumes the object exists,
+// since it can't tell.
+func apiExists(pkg *packages.Package, name string) bool {
+	if pkg == nil {
+		return false
+	}
+	if pkg.Types == nil {
+		return true
+	}
+	objName, member := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		objName, member = name[:i], name[i+1:]
+	}
+	obj := pkg.Types.Scope().Lookup(objName)
+	if obj == nil {
+		return false
+	}
+	if member == "" {
+		return true
+	}
+	m, _, _ := types.LookupFieldOrMethod(obj.Type(), true, pkg.Types, member)
+	return m != nil
+}
+
+// deprecatedSince returns the version in which each of the given APIs of
+// module modPath was deprecated. apis maps package paths relative to modPath
+// to sets of names, as in findDeprecated, of APIs deprecated in version.
+//
+// deprecatedSince looks for earlier release versions with the same major
+// version, latest first, and downloads them until it finds a version in
+// which an API was not deprecated. An API that was deprecated in all earlier
+// versions was deprecated in the first one.
+func deprecatedSince(modPath, version string, apis map[string]map[string]bool, env []string) (map[string]map[string]string, error) {
+	since := make(map[string]map[string]string)
+	pending := make(map[string]map[string]bool)
+	for rel, names := range apis {
+		since[rel] = make(map[string]string)
+		pending[rel] = make(map[string]bool)
+		for name := range names {
+			since[rel][name] = version
+			pending[rel][name] = true
+		}
+	}
+
+	versions, err := loadVersions(modPath, env)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(versions) - 1; i >= 0 && len(pending) > 0; i-- {
+		v := versions[i]
+		if semver.Compare(v, version) >= 0 || semver.Major(v) != semver.Major(version) || semver.Prerelease(v) != "" {
+			continue
+		}
+		modRoot, _, _, err := downloadModule(module.Version{Path: modPath, Version: v}, env)
+		if err != nil {
+			return nil, err
+		}
+		deprecated, err := findDeprecatedInDir(modRoot)
+		if err != nil {
+			return nil, err
+		}
+		for rel, names := range pending {
+			for name := range names {
+				if deprecated[rel][name] {
+					since[rel][name] = v
+				} else {
+					delete(names, name)
+				}
+			}
+			if len(names) == 0 {
+				delete(pending, rel)
+			}
+		}
+	}
+	return since, nil
+}
+
+// findDeprecatedInDir returns the deprecated exported objects of the
+// packages in the module whose root directory is modRoot, as findDeprecated
+// does for loaded packages. Package paths are relative to the module path.
+// Test files are ignored, and build constraints are not applied.
+func findDeprecatedInDir(modRoot string) (map[string]map[string]bool, error) {
+	deprecated := make(map[string]map[string]bool)
+	err := parseModuleFiles(modRoot, parser.ParseComments, func(filename string, f *ast.File) {
+		if strings.HasSuffix(filename, "_test.go") {
+			return
+		}
+		rel, err := filepath.Rel(modRoot, filepath.Dir(filename))
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		for _, name := range deprecatedInFile(f) {
+			if deprecated[rel] == nil {
+				deprecated[rel] = make(map[string]bool)
+			}
+			deprecated[rel][name] = true
+		}
+	})
+	return deprecated, err
+}
+
+// jsonDeprecations describes changes to deprecated APIs in a jsonReport.
+// APIs are named by package path and object name, as in
+// "example.com/mod/pkg.T.M".
+type jsonDeprecations struct {
+	// Added lists the APIs deprecated in the release version.
+	Added []string `json:",omitempty"`
+
+	// Removed lists the deprecated APIs that were removed.
+	Removed []jsonDeprecation `json:",omitempty"`
+
+	// Removable lists the deprecated APIs that should be removed in a new
+	// major version.
+	Removable []jsonDeprecation `json:",omitempty"`
+}
+
+// jsonDeprecation describes an API deprecated since a version.
+type jsonDeprecation struct {
+	API, Since string
+}
+
+func (dr *deprecationReport) jsonDeprecations() *jsonDeprecations {
+	jd := &jsonDeprecations{}
+	for _, d := range dr.added {
+		jd.Added = append(jd.Added, d.String())
+	}
+	for _, d := range dr.removed {
+		jd.Removed = append(jd.Removed, jsonDeprecation{API: d.String(), Since: d.since})
+	}
+	for _, d := range dr.removable {
+		jd.Removable = append(jd.Removable, jsonDeprecation{API: d.String(), Since: d.since})
+	}
+	return jd
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// checkGoMod reports problems with the release version's go.mod file that
+// don't prevent the module from being loaded, but that the author should be
+// aware of before tagging a release.
+//
+// Problems are reported as warnings, which don't affect the success of the
+// report.
+func (r *report) checkGoMod() {
+	f := r.release.goModFile
+	warnf := func(format string, args ...interface{}) {
+		r.release.warnings = append(r.release.warnings, fmt.Sprintf(format, args...))
+	}
+
+	// Retractions are declared in the latest version of a module, so the
+	// release version's go.mod may retract the base version.
+	var retractions []*modfile.Retract
+	retractions = append(retractions, f.Retract...)
+	if r.base.goModFile != nil && r.base.modPath == r.release.modPath {
+		retractions = append(retractions, r.base.goModFile.Retract...)
+	}
+	if r.base.version != "none" && r.base.modPath == r.release.modPath {
+		if ret := findRetraction(retractions, r.base.version); ret != nil {
+			warnf("Base version %s is retracted%s", r.base.version, rationaleSuffix(ret))
+		}
+	}
+	if r.release.version != "" {
+		if ret := findRetraction(retractions, r.release.version); ret != nil {
+			warnf("Version %s is retracted%s", r.release.version, rationaleSuffix(ret))
+		}
+	}
+
+	if r.base.goModFile != nil && r.base.goModFile.Go != nil && f.Go != nil {
+		baseGo, releaseGo := r.base.goModFile.Go.Version, f.Go.Version
+		switch compareGoVersions(baseGo, releaseGo) {
+		case -1:
+			warnf("go.mod: go directive raised from %s to %s", baseGo, releaseGo)
+		case 1:
+			warnf("go.mod: go directive lowered from %s to %s", baseGo, releaseGo)
+		}
+	}
+
+	// ParseLax ignores replace and exclude directives, so look for them in
+	// the syntax tree.
+	for _, verb := range []string{"replace", "exclude"} {
+		if lines := directiveLines(f, verb); len(lines) > 0 {
+			warnf("go.mod: %s directives are ignored when the module is required by other modules:\n\t%s", verb, strings.Join(lines, "\n\t"))
+		}
+	}
+
+	var pseudo, pre []string
+	for _, req := range f.Require {
+		switch {
+		case isPseudoVersion(req.Mod.Version):
+			pseudo = append(pseudo, req.Mod.String())
+		case semver.Prerelease(req.Mod.Version) != "":
+			pre = append(pre, req.Mod.String())
+		}
+	}
+	if len(pre) > 0 {
+		warnf("go.mod: the following requirements are on pre-release versions\n\t%s", strings.Join(pre, "\n\t"))
+	}
+	if len(pseudo) > 0 {
+		warnf("go.mod: the following requirements are on pseudo-versions\n\t%s", strings.Join(pseudo, "\n\t"))
+	}
+}
+
+// checkPublishedRetractions warns if the base version is retracted by the
+// latest published version of the module, as reported by
+// 'go list -m -retracted'. Retractions in the release version's go.mod are
+// reported by checkGoMod, so they aren't reported again. If the go command
+// can't look up the latest version, for example because GOPROXY is off, no
+// retractions are reported.
+func (r *report) checkPublishedRetractions(env []string) error {
+	if r.base.version == "none" || r.base.modPath != r.release.modPath {
+		return nil
+	}
+	if findRetraction(r.release.goModFile.Retract, r.base.version) != nil {
+		return nil
+	}
+	rationale, err := listRetractions(r.base.modPath, r.base.version, env)
+	if err != nil || len(rationale) == 0 {
+		return err
+	}
+	r.release.warnings = append(r.release.warnings, fmt.Sprintf("Base version %s is retracted by a later version of the module: %s", r.base.version, strings.Join(rationale, "; ")))
+	return nil
+}
+
+// listRetractions returns the rationale for the retraction of the given
+// version of a module, or nil if the version is not retracted. The go command
+// fills in a rationale if the retract directive has none.
+func listRetractions(modPath, version string, env []string) (rationale []string, err error) {
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("could not check retractions of %s@%s: %w", modPath, version, err)
+		}
+	}()
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if rerr := os.Remove(tmpDir); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	cmd := exec.Command("go", "list", "-m", "-retracted", "-json", "--", modPath+"@"+version)
+	cmd.Dir = tmpDir
+	cmd.Env = append(env[:len(env):len(env)], "GO111MODULE=on")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, cleanCmdError(err)
+	}
+	var m struct{ Retracted []string }
+	if err := json.Unmarshal(out, &m); err != nil {
+		return nil, err
+	}
+	return m.Retracted, nil
+}
+
+// compareGoVersions returns -1, 0, or +1 depending on whether the Go
+// version x is less than, equal to, or greater than y. Versions are ordered
+// as by the go command, so that 1.21 < 1.21rc1 < 1.21.0 < 1.21.1.
+// Invalid versions compare less than valid ones and equal to each other.
+func compareGoVersions(x, y string) int {
+	vx, vy := parseGoVersion(x), parseGoVersion(y)
+	for i := range vx {
+		if c := compareGoVersionParts(vx[i], vy[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// goVersionRE matches a Go version like 1.21, 1.21rc1 or 1.21.0.
+var goVersionRE = regexp.MustCompile(`^([1-9][0-9]*)\.(0|[1-9][0-9]*)(?:\.(0|[1-9][0-9]*)|(alpha|beta|rc)([1-9][0-9]*))?$`)
+
+// parseGoVersion splits the Go version v into its major, minor and patch
+// numbers and its pre-release kind and number, or returns all empty parts if
+// v is invalid. The kind of a release that is not a pre-release sorts after
+// all pre-release kinds, and a language version like 1.21 has neither a
+// patch number nor a kind, so that it sorts before all releases of 1.21.
+func parseGoVersion(v string) [5]string {
+	m := goVersionRE.FindStringSubmatch(v)
+	if m == nil {
+		return [5]string{}
+	}
+	p := [5]string{m[1], m[2], m[3], m[4], m[5]}
+	if p[2] != "" {
+		p[3] = "~" // release
+	}
+	return p
+}
+
+// compareGoVersionParts compares two parts of Go versions. Decimal numbers
+// are compared numerically, and an empty part is less than any other.
+func compareGoVersionParts(x, y string) int {
+	switch {
+	case x == y:
+		return 0
+	case x == "":
+		return -1
+	case y == "":
+		return +1
+	case x[0] >= '0' && x[0] <= '9' && len(x) != len(y):
+		if len(x) < len(y) {
+			return -1
+		}
+		return +1
+	case x < y:
+		return -1
+	}
+	return +1
+}
+
+// findRetraction returns the retract directive that covers version, or nil
+// if there is none.
+func findRetraction(retractions []*modfile.Retract, version string) *modfile.Retract {
+	for _, ret := range retractions {
+		if semver.Compare(ret.Low, version) <= 0 && semver.Compare(version, ret.High) <= 0 {
+			return ret
+		}
+	}
+	return nil
+}
+
+func rationaleSuffix(ret *modfile.Retract) string {
+	if ret.Rationale == "" {
+		return "."
+	}
+	return ": " + ret.Rationale
+}
+
+// directiveLines returns the arguments of each directive with the given verb
+// in f, whether the directive is on its own line or in a block.
+func directiveLines(f *modfile.File, verb string) []string {
+	var lines []string
+	for _, stmt := range f.Syntax.Stmt {
+		switch stmt := stmt.(type) {
+		case *modfile.Line:
+			if len(stmt.Token) > 1 && stmt.Token[0] == verb {
+				lines = append(lines, strings.Join(stmt.Token[1:], " "))
+			}
+		case *modfile.LineBlock:
+			if len(stmt.Token) == 1 && stmt.Token[0] == verb {
+				for _, l := range stmt.Line {
+					lines = append(lines, strings.Join(l.Token, " "))
+				}
+			}
+		}
+	}
+	return lines
+}
+
+var pseudoVersionRE = regexp.MustCompile(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// isPseudoVersion reports whether v is a pseudo-version.
+// Copied from cmd/go/internal/modfetch.IsPseudoVersion.
+func isPseudoVersion(v string) bool {
+	return strings.Count(v, "-") >= 2 && semver.IsValid(v) && pseudoVersionRE.MatchString(v)
+}
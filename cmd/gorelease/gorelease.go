@@ -7,7 +7,7 @@
 //
 // Usage:
 //
-//    gorelease [-base={version|none}] [-version=version]
+//    gorelease [-base={version|none|dir:path}] [-version=version] [-proxy=url] [-json]
 //
 // Examples:
 //
@@ -23,6 +23,9 @@
 //    # Compare with a specific version and check a specific new version for compatibility.
 //    gorelease -base=v1.2.3 -version=v1.3.0
 //
+//    # Compare with v1.2.3 checked out in another directory, without network access.
+//    gorelease -base=dir:../mod-v1.2.3@v1.2.3 -proxy=off
+//
 // gorelease analyzes changes in the public API and dependencies of the main
 // module. It compares a base version (set with -base) with the currently
 // checked out revision. Given a proposed version to release (set with
@@ -53,6 +56,26 @@
 //
 // For more information on semantic versioning, see https://semver.org.
 //
+// gorelease also checks the module's go.mod file. It warns if the proposed
+// version or the base version is retracted by a retract directive, if the go
+// directive was raised or lowered, if there are replace or exclude
+// directives, which have no effect when the module is required by other
+// modules, or if the module requires pre-release versions or pseudo-versions
+// of other modules. It also warns if a downloaded base version is retracted
+// by the latest published version of the module, as reported by
+// 'go list -m -retracted'. Warnings don't affect the exit status.
+//
+// gorelease lists the requirements in go.mod that were added, removed,
+// upgraded, or downgraded since the base version, noting whether the major,
+// minor, or patch version of an upgraded or downgraded requirement changed.
+// A requirement replaced by one on a new major version of the same module,
+// like example.com/dep/v2 instead of example.com/dep, is a major upgrade.
+// Types from dependencies that appear in the module's exported API, like the
+// type of a function parameter, are part of that API, so gorelease compares
+// those types in the required versions of the dependency and reports their
+// changes with the packages that use them. Like other changes, they affect
+// whether a version is valid and which version is suggested.
+//
 // Note: gorelease does not accept build metadata in releases (like
 // v1.0.0+debug). Although it is valid semver, the Go tool and other tools in
 // the ecosystem do not support it, so its use is not recommended.
@@ -70,11 +93,140 @@
 // attempt to infer a base version from the -version flag and available released
 // versions.
 //
+// The base version may also be loaded from a local directory instead of being
+// downloaded, with -base=dir:path@version, where path is a directory containing
+// the base version's go.mod file, like a checked-out revision of the module's
+// repository or an extracted module zip file. If @version is omitted, the
+// version is inferred as above. If the whole value after "dir:" is a
+// directory, like $GOMODCACHE/example.com/mod@v1.2.3 in the module cache, no
+// version is split off; add another @version to specify one.
+//
 // -version=version: The proposed version to be released. If specified,
 // gorelease will confirm whether this version is consistent with changes made
 // to the module's public API. gorelease will exit with a non-zero status if the
 // version is not valid.
 //
+// -proxy=url: The module proxy from which the base version and the module's
+// dependencies are downloaded, instead of the one set with GOPROXY. The value
+// may be any GOPROXY setting, like "off" to use only modules in the module
+// cache, or a local directory with the layout of a module proxy (like
+// $GOPATH/pkg/mod/cache/download), which is used with a file:// URL. With a
+// local proxy or -base=dir:path, gorelease can be used without network
+// access. Note that the go command verifies downloaded modules with the
+// checksum database unless GOSUMDB or GONOSUMDB says otherwise.
+//
+// -platforms=list: A space-separated list of platforms for which packages
+// are loaded and compared, like "linux/amd64 windows/amd64 darwin/arm64".
+// Each platform is a GOOS/GOARCH pair, optionally followed by ",cgo" or
+// ",nocgo" to set CGO_ENABLED. Changes that occur on only some of the
+// platforms are reported with those platforms. A change that is
+// incompatible on any platform is incompatible; for example, removing a
+// function on Windows breaks users on Windows, even if the function is still
+// available elsewhere. By default, packages are loaded once, for the current
+// environment.
+//
+// -submodules={auto|none|dir,...}: Nested modules whose imports of the
+// module's internal packages are checked. Internal packages imported by
+// nested modules are compared like other packages, since changes to them
+// may break the nested modules. With "auto", the default, gorelease finds
+// all modules nested in the module's directory. With "none", internal
+// packages are never compared. Otherwise, the value is a comma-separated
+// list of directories of nested modules, relative to the module's root
+// directory.
+//
+// -json: Write the report as JSON instead of text. The report is an object
+// with the following fields. Fields with empty values are omitted.
+//
+//    Base, Release   the compared module versions, each an object with the
+//                    fields Path, Version, VersionQuery, VersionInferred,
+//                    TagPrefix and GoVersion. Release.Version is the
+//                    version given with -version or the suggested version.
+//    Packages        the packages with API changes or errors, each an
+//                    object with the fields Path, ImportedBy (see
+//                    -submodules), Incompatible and Compatible, which are
+//                    lists of changes, and BaseErrors and ReleaseErrors,
+//                    which are lists of messages. Each change is an object
+//                    with the fields Message, Compatible, Package, Object,
+//                    Part, Kind, Old, New and Platforms, as written by
+//                    golang.org/x/exp/apidiff
+//    Diagnostics     problems not related to specific packages
+//    Warnings        problems that don't prevent a release, such as replace
+//                    directives in go.mod
+//    RequirementChanges
+//                    changed go.mod requirements, each an object with the
+//                    fields Path, Base and Release, the versions required
+//                    by each version of the module, Kind ("added",
+//                    "removed", "upgraded" or "downgraded"), Level
+//                    ("major", "minor", "patch" or "pre-release") and
+//                    ReexportedBy, the packages whose APIs include changed
+//                    types from the requirement
+//    VersionInvalid  an object with the fields Message and Reason,
+//                    explaining why the version is not valid or could not
+//                    be suggested
+//    Success         whether the module appears to be safe to release
+//
+// New fields may be added in later versions of gorelease.
+//
+// -notes: Write release notes for the proposed or suggested version in
+// Markdown instead of the report. The notes are a section headed by the
+// version, or by "Unreleased" if no valid version is known, listing breaking
+// changes, new APIs, APIs that were deprecated (with a "Deprecated:"
+// paragraph in their doc comments), and changes to requirements.
+//
+// -changelog=file: Add release notes, as written with -notes, to the given
+// changelog file, before its first section with a level-two heading, which
+// usually describes the latest version. The file is created if it doesn't
+// exist. The notes are also written to standard output.
+//
+// -commits: With -notes or -changelog, also list the commits that changed the
+// module's directory since the tag of the base version, with their subjects
+// and abbreviated hashes. The module must be in a git repository.
+//
+// -deprecations: Report APIs that were deprecated in the release (with a
+// "Deprecated:" paragraph in their doc comments), and deprecated APIs that
+// were removed, with the version in which they were deprecated. When the
+// release increments the major version, gorelease also suggests removing APIs
+// that were deprecated more than -deprecation-age minor versions before the
+// base version. Finding the version in which an API was deprecated requires
+// downloading earlier versions of the module. Without a base version, no
+// deprecations are reported.
+//
+// -deprecation-age=n: The number of minor versions after which deprecated
+// APIs should be removed in a new major version, as reported with
+// -deprecations, which this flag implies. The default is 2.
+//
+// -zip: Add a section to the report describing the module zip file that
+// would be created for the release: its total size and the size of its largest
+// directories, compared with the limit on module zip files; the files and
+// directories that are left out, like vendor directories and nested modules;
+// files that prevent the zip from being created, like files with invalid
+// names; and whether it includes a LICENSE file. gorelease warns if there is no
+// LICENSE file, or if the LICENSE file changed since the base version.
+//
+// -tag=check: Check the version tags in the module's git repository. The tag
+// for the proposed or suggested version, with the prefix for modules in
+// subdirectories, must not exist yet. The tag for the base version must have
+// the same content as the base version in the module cache; if the tag was
+// moved after the version was published, gorelease reports an error.
+//
+// -tag=create: Check the version tags as with -tag=check, then, if the report
+// has no errors and the module's directory has no uncommitted changes, create
+// an annotated tag for the release version at the current commit. The tag's
+// message contains the report. The tag is not pushed.
+//
+// -plan: Instead of checking the main module, check every module in the
+// repository containing the current directory, comparing each with its latest
+// release, and list the modules in the order they should be released: each
+// module after the modules in the repository that it requires. The plan shows
+// the suggested version for each module and flags requirements on other
+// modules in the repository that must be upgraded, because the requiring
+// module uses APIs added since the required version. New APIs are only
+// detected when referred to as pkg.Name, so new methods and fields are not
+// flagged. Each module is loaded with the other modules in the repository
+// replaced by their directories, and errors in its packages are listed in
+// the plan. -plan cannot be used with -base, -version, -json, -notes, or
+// -changelog.
+//
 // gorelease is eventually intended to be merged into the go command
 // as "go release". See golang.org/issues/26420.
 package main
@@ -107,17 +259,7 @@ import (
 // * Should we suggest versions at all or should -version be mandatory?
 // * Verify downstream modules have licenses. May need an API or library
 //   for this. Be clear that we can't provide legal advice.
-// * Internal packages may be relevant to submodules (for example,
-//   golang.org/x/tools/internal/lsp is imported by golang.org/x/tools).
-//   gorelease should detect whether this is the case and include internal
-//   directories in comparison. It should be possible to opt out or specify
-//   a different list of submodules.
-// * Decide what to do about build constraints, particularly GOOS and GOARCH.
-//   The API may be different on some platforms (e.g., x/sys).
-//   Should gorelease load packages in multiple configurations in the same run?
-//   Is it a compatible change if the same API is available for more platforms?
-//   Is it an incompatible change for fewer?
-//   How about cgo? Is adding a new cgo dependency an incompatible change?
+// * Is adding a new cgo dependency an incompatible change?
 // * Support splits and joins of nested modules. For example, if we are
 //   proposing to tag a particular commit as both cloud.google.com/go v0.46.2
 //   and cloud.google.com/go/storage v1.0.0, we should ensure that the sets of
@@ -163,9 +305,21 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 	fs := flag.NewFlagSet("gorelease", flag.ContinueOnError)
 	fs.Usage = func() {}
 	fs.SetOutput(ioutil.Discard)
-	var baseOpt, releaseVersion string
+	var baseOpt, releaseVersion, submodules, platformList, proxy, tagMode string
 	fs.StringVar(&baseOpt, "base", "", "previous version to compare against")
+	fs.StringVar(&platformList, "platforms", "", "space-separated list of platforms to compare, as GOOS/GOARCH[,cgo|,nocgo]")
+	fs.StringVar(&proxy, "proxy", "", "module proxy URL or directory to use instead of GOPROXY")
+	fs.StringVar(&submodules, "submodules", "auto", "nested modules whose imports of internal packages are checked: auto, none, or a list of directories")
+	fs.StringVar(&tagMode, "tag", "", "check version tags in the git repository, or check them and create the release tag: check or create")
 	fs.StringVar(&releaseVersion, "version", "", "proposed version to be released")
+	jsonOutput := fs.Bool("json", false, "write the report as JSON")
+	notes := fs.Bool("notes", false, "write Markdown release notes instead of the report")
+	changelog := fs.String("changelog", "", "add release notes to the given changelog file")
+	commits := fs.Bool("commits", false, "list commits since the base version in release notes")
+	deprecations := fs.Bool("deprecations", false, "report deprecated APIs and deprecated APIs that were removed")
+	deprecationAge := fs.Int("deprecation-age", 2, "minor versions after which deprecated APIs should be removed in a new major version")
+	zipOpt := fs.Bool("zip", false, "report on the files and size of the module zip file and on its license")
+	plan := fs.Bool("plan", false, "suggest versions for all modules in the repository and the order to release them")
 	if err := fs.Parse(args); err != nil {
 		return false, &usageError{err: err}
 	}
@@ -174,6 +328,55 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 		return false, usageErrorf("no arguments allowed")
 	}
 
+	if *changelog != "" {
+		*notes = true
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "deprecation-age" {
+			*deprecations = true
+		}
+	})
+	if *notes && *jsonOutput {
+		return false, usageErrorf("-json cannot be used with -notes or -changelog")
+	}
+	if *commits && !*notes {
+		return false, usageErrorf("-commits can only be used with -notes or -changelog")
+	}
+	if tagMode != "" && tagMode != "check" && tagMode != "create" {
+		return false, usageErrorf("-tag must be check or create")
+	}
+	if *deprecationAge < 0 {
+		return false, usageErrorf("-deprecation-age must not be negative")
+	}
+	if *deprecations && *notes {
+		return false, usageErrorf("-deprecations cannot be used with -notes or -changelog")
+	}
+	if *zipOpt && *notes {
+		return false, usageErrorf("-zip cannot be used with -notes or -changelog")
+	}
+	if *plan && (baseOpt != "" || releaseVersion != "" || *jsonOutput || *notes || tagMode != "" || *zipOpt) {
+		return false, usageErrorf("-plan cannot be used with -base, -version, -json, -notes, -changelog, -tag, or -zip")
+	}
+
+	plats, err := parsePlatforms(platformList)
+	if err != nil {
+		return false, err
+	}
+
+	// env is the environment for go commands run by gorelease.
+	env := os.Environ()
+	if proxy != "" {
+		goproxy, err := goproxyValue(proxy, dir)
+		if err != nil {
+			return false, err
+		}
+		env = append(env, "GOPROXY="+goproxy)
+	}
+
+	if *plan {
+		return runPlan(w, dir, plats, env)
+	}
+
 	if releaseVersion != "" {
 		if semver.Build(releaseVersion) != "" {
 			return false, usageErrorf("release version %q is not a canonical semantic version: build metadata is not supported", releaseVersion)
@@ -183,8 +386,33 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 		}
 	}
 
-	var baseModPath, baseVersion string
-	if at := strings.Index(baseOpt, "@"); at >= 0 {
+	var baseDir, baseModPath, baseVersion string
+	if strings.HasPrefix(baseOpt, "dir:") {
+		baseDir = strings.TrimPrefix(baseOpt, "dir:")
+		if baseDir == "" {
+			return false, usageErrorf("-base=dir: must be followed by a directory")
+		}
+		// Directories in the module cache have names like m@v1.2.3, so the
+		// version is split off only if the whole path is not a directory.
+		absDir := func(d string) string {
+			if filepath.IsAbs(d) {
+				return d
+			}
+			return filepath.Join(dir, d)
+		}
+		if fi, err := os.Stat(absDir(baseDir)); err != nil || !fi.IsDir() {
+			if at := strings.LastIndex(baseDir, "@"); at >= 0 && semver.IsValid(baseDir[at+1:]) {
+				baseDir, baseVersion = baseDir[:at], baseDir[at+1:]
+				if baseVersion != module.CanonicalVersion(baseVersion) {
+					return false, usageErrorf("base version %q is not a canonical semantic version", baseVersion)
+				}
+				if baseDir == "" {
+					return false, usageErrorf("-base=dir: must be followed by a directory")
+				}
+			}
+		}
+		baseDir = absDir(baseDir)
+	} else if at := strings.Index(baseOpt, "@"); at >= 0 {
 		baseModPath = baseOpt[:at]
 		baseVersion = baseOpt[at+1:]
 	} else if dot, slash := strings.Index(baseOpt, "."), strings.Index(baseOpt, "/"); dot >= 0 && slash >= 0 && dot < slash {
@@ -194,7 +422,7 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 	}
 	if baseModPath == "" {
 		if baseVersion != "" && semver.Canonical(baseVersion) == baseVersion && releaseVersion != "" {
-			if cmp := semver.Compare(baseOpt, releaseVersion); cmp == 0 {
+			if cmp := semver.Compare(baseVersion, releaseVersion); cmp == 0 {
 				return false, usageErrorf("-base and -version must be different")
 			} else if cmp > 0 {
 				return false, usageErrorf("base version (%q) must be lower than release version (%q)", baseVersion, releaseVersion)
@@ -211,20 +439,55 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 	}
 	repoRoot := findRepoRoot(modRoot)
 
+	// Check the files that would go into the module zip file. If the zip
+	// can't be created, the release version can't be loaded, so report why
+	// instead of failing with an error.
+	var zr *zipReport
+	if *zipOpt {
+		if zr, err = checkModuleZip(modRoot, repoRoot); err != nil {
+			return false, err
+		}
+		if !zr.isValid() {
+			goModData, err := ioutil.ReadFile(filepath.Join(modRoot, "go.mod"))
+			if err != nil {
+				return false, err
+			}
+			report := report{
+				release: moduleInfo{modRoot: modRoot, repoRoot: repoRoot, modPath: modfile.ModulePath(goModData)},
+				zip:     zr,
+			}
+			report.release.diagnostics = []string{"The module zip file can't be created, so packages were not loaded or compared."}
+			if *jsonOutput {
+				err = report.JSON(w)
+			} else {
+				err = report.Text(w)
+			}
+			return false, err
+		}
+	}
+
 	// Load packages for the version to be released from the local directory.
-	release, err := loadLocalModule(modRoot, repoRoot, releaseVersion)
+	release, err := loadLocalModule(modRoot, repoRoot, releaseVersion, nil, plats, env)
 	if err != nil {
 		return false, err
 	}
+	if release.submoduleImports, err = findSubmoduleImports(modRoot, release.modPath, submodules); err != nil {
+		return false, err
+	}
 
 	// Find the base version if there is one, download it, and load packages from
-	// the module cache.
-	var max string
-	if baseModPath == "" {
-		baseModPath = release.modPath
-		max = releaseVersion
+	// the module cache, or load them from the base directory.
+	var base moduleInfo
+	if baseDir != "" {
+		base, err = loadDirModule(baseDir, baseVersion, release.modPath, releaseVersion, plats, env)
+	} else {
+		var max string
+		if baseModPath == "" {
+			baseModPath = release.modPath
+			max = releaseVersion
+		}
+		base, err = loadDownloadedModule(baseModPath, baseVersion, max, plats, env)
 	}
-	base, err := loadDownloadedModule(baseModPath, baseVersion, max)
 	if err != nil {
 		return false, err
 	}
@@ -234,9 +497,48 @@ func runRelease(w io.Writer, dir string, args []string) (success bool, err error
 	if err != nil {
 		return false, err
 	}
-	if err := report.Text(w); err != nil {
+	if baseDir == "" {
+		if err := report.checkPublishedRetractions(env); err != nil {
+			return false, err
+		}
+	}
+	// Release notes list newly deprecated APIs, but looking for deprecated
+	// APIs means parsing all files again, so it's only done when needed.
+	if *notes || *deprecations {
+		report.loadDeprecations()
+	}
+	if *deprecations {
+		if err := report.trackDeprecations(*deprecationAge, env); err != nil {
+			return false, err
+		}
+	}
+	if zr != nil {
+		report.zip = zr
+		if err := report.checkLicense(); err != nil {
+			return false, err
+		}
+	}
+	if tagMode != "" {
+		if err := report.checkTags(); err != nil {
+			return false, err
+		}
+	}
+	switch {
+	case *jsonOutput:
+		err = report.JSON(w)
+	case *notes:
+		err = writeNotes(w, &report, *commits, *changelog, dir)
+	default:
+		err = report.Text(w)
+	}
+	if err != nil {
 		return false, err
 	}
+	if tagMode == "create" {
+		if err := report.createTag(w); err != nil {
+			return false, err
+		}
+	}
 	return report.isSuccessful(), nil
 }
 
@@ -249,6 +551,7 @@ type moduleInfo struct {
 	versionInferred bool   // true if the version was unspecified and inferred
 	modPathMajor    string // major version suffix like "/v3" or ".v2"
 	tagPrefix       string // prefix for version tags if module not in repo root
+	zipSum          string // hash of the module zip, for downloaded modules
 
 	goModPath string        // file path to go.mod
 	goModData []byte        // content of go.mod
@@ -256,7 +559,23 @@ type moduleInfo struct {
 	goModFile *modfile.File // parsed go.mod file
 
 	diagnostics []string            // problems not related to loading specific packages
+	warnings    []string            // like diagnostics, but not preventing a release
 	pkgs        []*packages.Package // loaded packages with type information
+
+	// platforms lists the platforms for which packages were loaded, and
+	// platformPkgs the packages loaded for each. pkgs is platformPkgs[0].
+	platforms    []platform
+	platformPkgs [][]*packages.Package
+
+	// deprecated maps package paths to the names of deprecated objects in
+	// those packages, as returned by findDeprecated. It is set by
+	// report.loadDeprecations.
+	deprecated map[string]map[string]bool
+
+	// submoduleImports maps the paths of internal packages that are imported
+	// by nested modules to the paths of those modules. It is only set for
+	// the release version.
+	submoduleImports map[string][]string
 }
 
 // loadLocalModule loads information about a module and its packages from a
@@ -267,44 +586,28 @@ type moduleInfo struct {
 // repoRoot is the root directory of the repository containing the module or "".
 //
 // version is a proposed version for the module or "".
-func loadLocalModule(modRoot, repoRoot, version string) (m moduleInfo, err error) {
+//
+// replace maps the paths of other modules to the local directories they are
+// loaded from instead of the versions the module requires, as when modules of
+// a repository are released together. It is nil otherwise.
+//
+// plats lists the platforms for which packages are loaded.
+//
+// env is the environment for go commands.
+func loadLocalModule(modRoot, repoRoot, version string, replace map[string]string, plats []platform, env []string) (m moduleInfo, err error) {
 	if repoRoot != "" && !hasFilePathPrefix(modRoot, repoRoot) {
 		return moduleInfo{}, fmt.Errorf("module root %q is not in repository root %q", modRoot, repoRoot)
 	}
 
 	// Load the go.mod file and check the module path and go version.
-	m = moduleInfo{
-		modRoot:   modRoot,
-		repoRoot:  repoRoot,
-		version:   version,
-		goModPath: filepath.Join(modRoot, "go.mod"),
+	if m, err = readLocalModule(modRoot, version); err != nil {
+		return moduleInfo{}, err
 	}
+	m.repoRoot = repoRoot
 
 	if version != "" && semver.Compare(version, "v0.0.0-99999999999999-zzzzzzzzzzzz") < 0 {
 		m.diagnostics = append(m.diagnostics, fmt.Sprintf("Version %s is lower than most pseudo-versions. Consider releasing v0.1.0-0 instead.", version))
 	}
-
-	m.goModData, err = ioutil.ReadFile(m.goModPath)
-	if err != nil {
-		return moduleInfo{}, err
-	}
-	m.goModFile, err = modfile.ParseLax(m.goModPath, m.goModData, nil)
-	if err != nil {
-		return moduleInfo{}, err
-	}
-	if m.goModFile.Module == nil {
-		return moduleInfo{}, fmt.Errorf("%s: module directive is missing", m.goModPath)
-	}
-	m.modPath = m.goModFile.Module.Mod.Path
-	if err := checkModPath(m.modPath); err != nil {
-		return moduleInfo{}, err
-	}
-	var ok bool
-	_, m.modPathMajor, ok = module.SplitPathVersion(m.modPath)
-	if !ok {
-		// we just validated the path above.
-		panic(fmt.Sprintf("could not find version suffix in module path %q", m.modPath))
-	}
 	if m.goModFile.Go == nil {
 		m.diagnostics = append(m.diagnostics, "go.mod: go directive is missing")
 	}
@@ -358,36 +661,95 @@ func loadLocalModule(modRoot, repoRoot, version string) (m moduleInfo, err error
 	}
 
 	// Load the module's packages.
-	// We pack the module into a zip file and extract it to a temporary directory
-	// as if it were published and downloaded. We'll detect any errors that would
-	// occur (for example, invalid file names). We avoid loading it as the
-	// main module.
-	tmpModRoot, err := copyModuleToTempDir(m.modPath, m.modRoot)
+	loadDiagnostics, err := m.loadLocalPackages(replace, plats, env)
+	if err != nil {
+		return moduleInfo{}, err
+	}
+	m.diagnostics = append(m.diagnostics, loadDiagnostics...)
+
+	return m, nil
+}
+
+// readLocalModule reads and parses the go.mod file of the module in modRoot
+// and checks its module path. version is the version of the module or "".
+func readLocalModule(modRoot, version string) (m moduleInfo, err error) {
+	m = moduleInfo{
+		modRoot:   modRoot,
+		version:   version,
+		goModPath: filepath.Join(modRoot, "go.mod"),
+	}
+	m.goModData, err = ioutil.ReadFile(m.goModPath)
+	if err != nil {
+		return moduleInfo{}, err
+	}
+	m.goModFile, err = modfile.ParseLax(m.goModPath, m.goModData, nil)
 	if err != nil {
 		return moduleInfo{}, err
 	}
+	if m.goModFile.Module == nil {
+		return moduleInfo{}, fmt.Errorf("%s: module directive is missing", m.goModPath)
+	}
+	m.modPath = m.goModFile.Module.Mod.Path
+	if err := checkModPath(m.modPath); err != nil {
+		return moduleInfo{}, err
+	}
+	var ok bool
+	_, m.modPathMajor, ok = module.SplitPathVersion(m.modPath)
+	if !ok {
+		// we just validated the path above.
+		panic(fmt.Sprintf("could not find version suffix in module path %q", m.modPath))
+	}
+	return m, nil
+}
+
+// loadLocalPackages loads the packages of the module read by readLocalModule
+// for each platform in plats, with other modules replaced as described in
+// loadLocalModule. It returns diagnostics about the module's go.mod and
+// go.sum files, as returned by loadPackages.
+//
+// We pack the module into a zip file and extract it to a temporary directory
+// as if it were published and downloaded. We'll detect any errors that would
+// occur (for example, invalid file names). We avoid loading it as the
+// main module.
+func (m *moduleInfo) loadLocalPackages(replace map[string]string, plats []platform, env []string) (diagnostics []string, err error) {
+	tmpModRoot, err := copyModuleToTempDir(m.modPath, m.modRoot)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if rerr := os.RemoveAll(tmpModRoot); err == nil && rerr != nil {
 			err = fmt.Errorf("removing temporary module directory: %v", rerr)
 		}
 	}()
-	tmpLoadDir, tmpGoModData, tmpGoSumData, err := prepareLoadDir(m.goModFile, m.modPath, tmpModRoot, version, false)
+	tmpLoadDir, tmpGoModData, tmpGoSumData, err := prepareLoadDir(m.goModFile, m.modPath, tmpModRoot, m.version, false, replace)
 	if err != nil {
-		return moduleInfo{}, err
+		return nil, err
 	}
 	defer func() {
 		if rerr := os.RemoveAll(tmpLoadDir); err == nil && rerr != nil {
 			err = fmt.Errorf("removing temporary load directory: %v", rerr)
 		}
 	}()
-	var loadDiagnostics []string
-	m.pkgs, loadDiagnostics, err = loadPackages(m.modPath, tmpModRoot, tmpLoadDir, tmpGoModData, tmpGoSumData)
+	m.platforms = plats
+	m.platformPkgs, diagnostics, err = loadPackages(m.modPath, tmpModRoot, tmpLoadDir, tmpGoModData, tmpGoSumData, plats, env)
 	if err != nil {
-		return moduleInfo{}, err
+		return nil, err
 	}
-	m.diagnostics = append(m.diagnostics, loadDiagnostics...)
+	m.pkgs = m.platformPkgs[0]
 
-	return m, nil
+	// The temporary copy is removed when we return, so refer to the module's
+	// files in modRoot instead, which have the same content.
+	prefix := tmpModRoot + string(os.PathSeparator)
+	for _, pkgs := range m.platformPkgs {
+		for _, pkg := range pkgs {
+			for i, file := range pkg.GoFiles {
+				if strings.HasPrefix(file, prefix) {
+					pkg.GoFiles[i] = filepath.Join(m.modRoot, file[len(prefix):])
+				}
+			}
+		}
+	}
+	return diagnostics, nil
 }
 
 // loadDownloadedModule downloads a module and loads information about it and
@@ -404,7 +766,11 @@ func loadLocalModule(modRoot, repoRoot, version string) (m moduleInfo, err error
 // If version is "" and max is not "", available versions greater than or equal
 // to max will not be considered. Typically, loadDownloadedModule is used to
 // load the base version, and max is the release version.
-func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error) {
+//
+// plats lists the platforms for which packages are loaded.
+//
+// env is the environment for go commands.
+func loadDownloadedModule(modPath, version, max string, plats []platform, env []string) (m moduleInfo, err error) {
 	// Check the module path and version.
 	// If the version is a query, resolve it to a canonical version.
 	m = moduleInfo{modPath: modPath}
@@ -427,7 +793,7 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 	if version == "" {
 		// Unspecified version: use the highest version below max.
 		m.versionInferred = true
-		if m.version, err = inferBaseVersion(modPath, max); err != nil {
+		if m.version, err = inferBaseVersion(modPath, max, env); err != nil {
 			return moduleInfo{}, err
 		}
 		if m.version == "none" {
@@ -436,7 +802,7 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 	} else if version != module.CanonicalVersion(version) {
 		// Version query: find the real version.
 		m.versionQuery = version
-		if m.version, err = queryVersion(modPath, version); err != nil {
+		if m.version, err = queryVersion(modPath, version, env); err != nil {
 			return moduleInfo{}, err
 		}
 		if m.version != "none" && max != "" && semver.Compare(m.version, max) >= 0 {
@@ -461,7 +827,7 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 	// which is not inside modRoot. This is what the go command uses. Even if
 	// the module didn't have a go.mod file, one will be synthesized there.
 	v := module.Version{Path: modPath, Version: m.version}
-	if m.modRoot, m.goModPath, err = downloadModule(v); err != nil {
+	if m.modRoot, m.goModPath, m.zipSum, err = downloadModule(v, env); err != nil {
 		return moduleInfo{}, err
 	}
 	if m.goModData, err = ioutil.ReadFile(m.goModPath); err != nil {
@@ -476,7 +842,7 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 	m.modPath = m.goModFile.Module.Mod.Path
 
 	// Load packages.
-	tmpLoadDir, tmpGoModData, tmpGoSumData, err := prepareLoadDir(nil, m.modPath, m.modRoot, m.version, true)
+	tmpLoadDir, tmpGoModData, tmpGoSumData, err := prepareLoadDir(nil, m.modPath, m.modRoot, m.version, true, nil)
 	if err != nil {
 		return moduleInfo{}, err
 	}
@@ -485,13 +851,61 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 			err = fmt.Errorf("removing temporary load directory: %v", err)
 		}
 	}()
-	if m.pkgs, _, err = loadPackages(m.modPath, m.modRoot, tmpLoadDir, tmpGoModData, tmpGoSumData); err != nil {
+	m.platforms = plats
+	if m.platformPkgs, _, err = loadPackages(m.modPath, m.modRoot, tmpLoadDir, tmpGoModData, tmpGoSumData, plats, env); err != nil {
 		return moduleInfo{}, err
 	}
+	m.pkgs = m.platformPkgs[0]
 
 	return m, nil
 }
 
+// loadDirModule loads information about a module and its packages from a
+// local directory, to be used as the base version. The directory may be a
+// checked-out revision of the module's repository or an extracted module zip
+// file, so the base version may be loaded without network access.
+//
+// version is the version of the module in the directory. If version is "",
+// it's inferred as in loadDownloadedModule: if the module path is
+// releaseModPath, the highest available version lower than releaseVersion
+// is used.
+//
+// plats lists the platforms for which packages are loaded.
+//
+// env is the environment for go commands.
+func loadDirModule(modRoot, version, releaseModPath, releaseVersion string, plats []platform, env []string) (m moduleInfo, err error) {
+	if fi, err := os.Stat(filepath.Join(modRoot, "go.mod")); err != nil || fi.IsDir() {
+		return moduleInfo{}, usageErrorf("-base: %s does not contain a go.mod file", modRoot)
+	}
+	// Problems with the base version were reported when it was released, so
+	// the checks made by loadLocalModule are skipped.
+	if m, err = readLocalModule(modRoot, ""); err != nil {
+		return moduleInfo{}, err
+	}
+	if _, err := m.loadLocalPackages(nil, plats, env); err != nil {
+		return moduleInfo{}, err
+	}
+
+	if version == "" {
+		var max string
+		if m.modPath == releaseModPath {
+			max = releaseVersion
+		}
+		m.versionInferred = true
+		if m.version, err = inferBaseVersion(m.modPath, max, env); err != nil {
+			return moduleInfo{}, err
+		}
+		if m.version == "none" {
+			return moduleInfo{}, &baseVersionError{err: fmt.Errorf("no versions of %s found; specify the version of the base directory with -base=dir:%s@version", m.modPath, modRoot)}
+		}
+	} else if err := module.CheckPathMajor(version, m.modPathMajor); err != nil {
+		return moduleInfo{}, fmt.Errorf("can't compare major versions: base version %s does not belong to module %s", version, m.modPath)
+	} else {
+		m.version = version
+	}
+	return m, nil
+}
+
 // makeReleaseReport returns a report comparing the current version of a
 // module with a previously released version. The report notes any backward
 // compatible and incompatible changes in the module's public API. It also
@@ -500,83 +914,27 @@ func loadDownloadedModule(modPath, version, max string) (m moduleInfo, err error
 // version control tag to use (with an appropriate prefix, for modules not
 // in the repository root directory).
 func makeReleaseReport(base, release moduleInfo) (report, error) {
-	// Compare each pair of packages.
-	// Ignore internal packages.
-	// If we don't have a base version to compare against,
-	// just check the new packages for errors.
-	shouldCompare := base.version != "none"
-	isInternal := func(modPath, pkgPath string) bool {
-		if !hasPathPrefix(pkgPath, modPath) {
-			panic(fmt.Sprintf("package %s not in module %s", pkgPath, modPath))
-		}
-		for pkgPath != modPath {
-			if path.Base(pkgPath) == "internal" {
-				return true
-			}
-			pkgPath = path.Dir(pkgPath)
-		}
-		return false
-	}
 	r := report{
-		base:    base,
-		release: release,
+		base:         base,
+		release:      release,
+		requirements: requirementChanges(base.goModFile, release.goModFile),
 	}
-	for _, pair := range zipPackages(base.modPath, base.pkgs, release.modPath, release.pkgs) {
-		basePkg, releasePkg := pair.base, pair.release
-		switch {
-		case releasePkg == nil:
-			// Package removed
-			if internal := isInternal(base.modPath, basePkg.PkgPath); !internal || len(basePkg.Errors) > 0 {
-				pr := packageReport{
-					path:       basePkg.PkgPath,
-					baseErrors: basePkg.Errors,
-				}
-				if !internal {
-					pr.Report = apidiff.Report{
-						Changes: []apidiff.Change{{
-							Message:    "package removed",
-							Compatible: false,
-						}},
-					}
-				}
-				r.addPackage(pr)
-			}
 
-		case basePkg == nil:
-			// Package added
-			if internal := isInternal(release.modPath, releasePkg.PkgPath); !internal && shouldCompare || len(releasePkg.Errors) > 0 {
-				pr := packageReport{
-					path:          releasePkg.PkgPath,
-					releaseErrors: releasePkg.Errors,
-				}
-				if !internal && shouldCompare {
-					// If we aren't comparing against a base version, don't say
-					// "package added". Only report packages with errors.
-					pr.Report = apidiff.Report{
-						Changes: []apidiff.Change{{
-							Message:    "package added",
-							Compatible: true,
-						}},
-					}
-				}
-				r.addPackage(pr)
-			}
-
-		default:
-			// Matched packages
-			// Both packages are internal or neither; we only consider path components
-			// after the module path.
-			internal := isInternal(release.modPath, releasePkg.PkgPath)
-			if !internal && basePkg.Name != "main" && releasePkg.Name != "main" {
-				pr := packageReport{
-					path:          basePkg.PkgPath,
-					baseErrors:    basePkg.Errors,
-					releaseErrors: releasePkg.Errors,
-					Report:        apidiff.Changes(basePkg.Types, releasePkg.Types),
-				}
-				r.addPackage(pr)
-			}
+	// Packages are compared separately for each platform.
+	var platReports [][]packageReport
+	for i, releasePkgs := range release.platformPkgs {
+		var basePkgs []*packages.Package
+		if base.platformPkgs != nil {
+			basePkgs = base.platformPkgs[i]
 		}
+		platReports = append(platReports, r.comparePackages(basePkgs, releasePkgs))
+	}
+	prs := platReports[0]
+	if len(release.platforms) > 1 {
+		prs = mergePackageReports(release.platforms, platReports, base.modPath, release.modPath)
+	}
+	for _, pr := range prs {
+		r.addPackage(pr)
 	}
 
 	if r.canVerifyReleaseVersion() {
@@ -586,6 +944,7 @@ func makeReleaseReport(base, release moduleInfo) (report, error) {
 			r.validateReleaseVersion()
 		}
 	}
+	r.checkGoMod()
 
 	return r, nil
 }
@@ -652,14 +1011,14 @@ func checkModPath(modPath string) error {
 // highest available release version. Pre-release versions are not considered.
 // If there is no available version, and max appears to be the first release
 // version (for example, "v0.1.0", "v2.0.0"), "none" is returned.
-func inferBaseVersion(modPath, max string) (baseVersion string, err error) {
+func inferBaseVersion(modPath, max string, env []string) (baseVersion string, err error) {
 	defer func() {
 		if err != nil {
 			err = &baseVersionError{err: err}
 		}
 	}()
 
-	versions, err := loadVersions(modPath)
+	versions, err := loadVersions(modPath, env)
 	if err != nil {
 		return "", err
 	}
@@ -679,7 +1038,7 @@ func inferBaseVersion(modPath, max string) (baseVersion string, err error) {
 }
 
 // queryVersion returns the canonical version for a given module version query.
-func queryVersion(modPath, query string) (resolved string, err error) {
+func queryVersion(modPath, query string, env []string) (resolved string, err error) {
 	defer func() {
 		if err != nil {
 			err = fmt.Errorf("could not resolve version %s@%s: %w", modPath, query, err)
@@ -701,7 +1060,7 @@ func queryVersion(modPath, query string) (resolved string, err error) {
 	arg := modPath + "@" + query
 	cmd := exec.Command("go", "list", "-m", "-f", "{{.Version}}", "--", arg)
 	cmd.Dir = tmpDir
-	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	cmd.Env = append(env[:len(env):len(env)], "GO111MODULE=on")
 	out, err := cmd.Output()
 	if err != nil {
 		return "", cleanCmdError(err)
@@ -712,7 +1071,7 @@ func queryVersion(modPath, query string) (resolved string, err error) {
 // loadVersions loads the list of versions for the given module using
 // 'go list -m -versions'. The returned versions are sorted in ascending
 // semver order.
-func loadVersions(modPath string) ([]string, error) {
+func loadVersions(modPath string, env []string) ([]string, error) {
 	tmpDir, err := ioutil.TempDir("", "")
 	if err != nil {
 		return nil, err
@@ -724,7 +1083,7 @@ func loadVersions(modPath string) ([]string, error) {
 	}()
 	cmd := exec.Command("go", "list", "-m", "-versions", "--", modPath)
 	cmd.Dir = tmpDir
-	cmd.Env = append(os.Environ(), "GO111MODULE=on")
+	cmd.Env = append(env[:len(env):len(env)], "GO111MODULE=on")
 	out, err := cmd.Output()
 	if err != nil {
 		return nil, cleanCmdError(err)
@@ -827,8 +1186,10 @@ func copyModuleToTempDir(modPath, modRoot string) (dir string, err error) {
 }
 
 // downloadModule downloads a specific version of a module to the
-// module cache using 'go mod download'.
-func downloadModule(m module.Version) (modRoot, goModPath string, err error) {
+// module cache using 'go mod download'. It returns the module's directory in
+// the cache, the path of its go.mod file, and the hash of its zip file, as
+// recorded in go.sum.
+func downloadModule(m module.Version, env []string) (modRoot, goModPath, sum string, err error) {
 	defer func() {
 		if err != nil {
 			err = &downloadError{m: m, err: cleanCmdError(err)}
@@ -843,36 +1204,70 @@ func downloadModule(m module.Version) (modRoot, goModPath string, err error) {
 	// If it didn't read go.mod in this case, we wouldn't need a temp directory.
 	tmpDir, err := ioutil.TempDir("", "gorelease-download")
 	if err != nil {
-		return "", "", err
+		return "", "", "", err
 	}
 	defer os.Remove(tmpDir)
 	cmd := exec.Command("go", "mod", "download", "-json", "--", m.Path+"@"+m.Version)
 	cmd.Dir = tmpDir
+	cmd.Env = env
 	out, err := cmd.Output()
 	var xerr *exec.ExitError
 	if err != nil {
 		var ok bool
 		if xerr, ok = err.(*exec.ExitError); !ok {
-			return "", "", err
+			return "", "", "", err
 		}
 	}
 
 	// If 'go mod download' exited unsuccessfully but printed well-formed JSON
 	// with an error, return that error.
-	parsed := struct{ Dir, GoMod, Error string }{}
+	parsed := struct{ Dir, GoMod, Sum, Error string }{}
 	if jsonErr := json.Unmarshal(out, &parsed); jsonErr != nil {
 		if xerr != nil {
-			return "", "", cleanCmdError(xerr)
+			return "", "", "", cleanCmdError(xerr)
 		}
-		return "", "", jsonErr
+		return "", "", "", jsonErr
 	}
 	if parsed.Error != "" {
-		return "", "", errors.New(parsed.Error)
+		return "", "", "", errors.New(parsed.Error)
 	}
 	if xerr != nil {
-		return "", "", cleanCmdError(xerr)
+		return "", "", "", cleanCmdError(xerr)
+	}
+	return parsed.Dir, parsed.GoMod, parsed.Sum, nil
+}
+
+// goproxyValue returns the value of GOPROXY for the -proxy flag value proxy.
+// A directory, which may be relative to dir, is used as a module proxy with
+// a file:// URL. It must have the layout of a module proxy, like the
+// $GOPATH/pkg/mod/cache/download directory of another machine. Other values,
+// like URLs or lists of URLs, are used as they are.
+func goproxyValue(proxy, dir string) (string, error) {
+	if proxy == "off" || proxy == "direct" || strings.Contains(proxy, "://") || strings.ContainsAny(proxy, ",|") {
+		return proxy, nil
+	}
+	if !filepath.IsAbs(proxy) {
+		proxy = filepath.Join(dir, proxy)
 	}
-	return parsed.Dir, parsed.GoMod, nil
+	proxy, err := filepath.Abs(proxy)
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(proxy); err != nil || !fi.IsDir() {
+		return "", usageErrorf("-proxy: %s is not a URL or a directory", proxy)
+	}
+	return fileURL(proxy), nil
+}
+
+// fileURL returns a file:// URL for the absolute file path p.
+func fileURL(p string) string {
+	// Make sure the URL path starts with a slash on Windows. Absolute paths
+	// normally start with a drive letter.
+	// TODO(golang.org/issue/32456): use url.FromFilePath when implemented.
+	if strings.HasPrefix(p, "/") {
+		return "file://" + p
+	}
+	return "file:///" + filepath.ToSlash(p)
 }
 
 // prepareLoadDir creates a temporary directory and a go.mod file that requires
@@ -891,7 +1286,10 @@ func downloadModule(m module.Version) (modRoot, goModPath string, err error) {
 // cached indicates whether the module is being loaded from the module cache.
 // If true, the module can be referenced with a simple requirement.
 // If false, the module will be referenced with a local replace directive.
-func prepareLoadDir(modFile *modfile.File, modPath, modRoot, version string, cached bool) (dir string, goModData, goSumData []byte, err error) {
+//
+// replace maps the paths of other modules to local directories that replace
+// them, whatever their required versions.
+func prepareLoadDir(modFile *modfile.File, modPath, modRoot, version string, cached bool, replace map[string]string) (dir string, goModData, goSumData []byte, err error) {
 	if module.Check(modPath, version) != nil {
 		// If no version is proposed or if the version isn't valid, use a fake
 		// version that matches the module's major version suffix. If the version
@@ -911,7 +1309,17 @@ func prepareLoadDir(modFile *modfile.File, modPath, modRoot, version string, cac
 	f.AddModuleStmt("gorelease-load-module")
 	f.AddRequire(modPath, version)
 	if !cached {
-		f.AddReplace(modPath, version, modRoot, "")
+		// Replace all versions, since the module may also be required by
+		// modules it requires, at another version.
+		f.AddReplace(modPath, "", modRoot, "")
+	}
+	replacePaths := make([]string, 0, len(replace))
+	for path := range replace {
+		replacePaths = append(replacePaths, path)
+	}
+	sort.Strings(replacePaths)
+	for _, path := range replacePaths {
+		f.AddReplace(path, "", replace[path], "")
 	}
 	if modFile != nil {
 		if modFile.Go != nil {
@@ -940,7 +1348,7 @@ func prepareLoadDir(modFile *modfile.File, modPath, modRoot, version string, cac
 	return dir, goModData, goSumData, nil
 }
 
-// loadPackages returns a list of all packages in the module modPath, sorted by
+// loadPackages returns lists of all packages in the module modPath, sorted by
 // package path. modRoot is the module root directory, but packages are loaded
 // from loadDir, which must contain go.mod and go.sum containing goModData and
 // goSumData.
@@ -949,12 +1357,85 @@ func prepareLoadDir(modFile *modfile.File, modPath, modRoot, version string, cac
 // directives are not applied. The loading process may also modify go.mod and
 // go.sum, and we want to detect and report differences.
 //
+// Packages are loaded once for each platform in plats, and the returned
+// lists of packages correspond to plats. env is the environment for go
+// commands, to which each platform's settings are added.
+//
 // Package loading errors will be returned in the Errors field of each package.
 // Other diagnostics (such as the go.sum file being incomplete) will be
 // returned through diagnostics.
 // err will be non-nil in case of a fatal error that prevented packages
 // from being loaded.
-func loadPackages(modPath, modRoot, loadDir string, goModData, goSumData []byte) (pkgs []*packages.Package, diagnostics []string, err error) {
+func loadPackages(modPath, modRoot, loadDir string, goModData, goSumData []byte, plats []platform, env []string) (pkgs [][]*packages.Package, diagnostics []string, err error) {
+	for _, plat := range plats {
+		platPkgs, err := loadPlatformPackages(modPath, modRoot, loadDir, plat, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		pkgs = append(pkgs, platPkgs)
+	}
+
+	// Report new requirements in go.mod.
+	goModPath := filepath.Join(loadDir, "go.mod")
+	loadReqs := func(data []byte) ([]string, error) {
+		modFile, err := modfile.ParseLax(goModPath, data, nil)
+		if err != nil {
+			return nil, err
+		}
+		lines := make([]string, len(modFile.Require))
+		for i, req := range modFile.Require {
+			lines[i] = req.Mod.String()
+		}
+		sort.Strings(lines)
+		return lines, nil
+	}
+
+	oldReqs, err := loadReqs(goModData)
+	if err != nil {
+		return nil, nil, err
+	}
+	newGoModData, err := ioutil.ReadFile(goModPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	newReqs, err := loadReqs(newGoModData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oldMap := make(map[string]bool)
+	for _, req := range oldReqs {
+		oldMap[req] = true
+	}
+	var missing []string
+	for _, req := range newReqs {
+		// A requirement on the module itself comes from a requirement cycle,
+		// and isn't needed in the module's own go.mod.
+		if !oldMap[req] && !strings.HasPrefix(req, modPath+"@") {
+			missing = append(missing, req)
+		}
+	}
+
+	if len(missing) > 0 {
+		diagnostics = append(diagnostics, fmt.Sprintf("go.mod: the following requirements are needed\n\t%s\nRun 'go mod tidy' to add missing requirements.", strings.Join(missing, "\n\t")))
+		return pkgs, diagnostics, nil
+	}
+
+	newGoSumData, err := ioutil.ReadFile(filepath.Join(loadDir, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	if !bytes.Equal(goSumData, newGoSumData) {
+		diagnostics = append(diagnostics, "go.sum: one or more sums are missing.\nRun 'go mod tidy' to add missing sums.")
+	}
+
+	return pkgs, diagnostics, nil
+}
+
+// loadPlatformPackages lists and loads the packages in the module modPath
+// for the platform plat, as described in loadPackages. The packages are
+// sorted by package path.
+func loadPlatformPackages(modPath, modRoot, loadDir string, plat platform, env []string) (pkgs []*packages.Package, err error) {
 	// List packages in the module.
 	// We can't just load example.com/mod/... because that might include packages
 	// in nested modules. We also can't filter packages from the output of
@@ -974,9 +1455,10 @@ func loadPackages(modPath, modRoot, loadDir string, goModData, goSumData []byte)
 	format := fmt.Sprintf(`{{if .Module}}{{if eq .Module.Path %q}}{{.ImportPath}}{{end}}{{end}}`, modPath)
 	cmd := exec.Command("go", "list", "-mod=mod", "-e", "-f", format, "--", modPath+"/...")
 	cmd.Dir = loadDir
+	cmd.Env = plat.environ(env)
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, nil, cleanCmdError(err)
+		return nil, cleanCmdError(err)
 	}
 	var pkgPaths []string
 	for len(out) > 0 {
@@ -993,16 +1475,30 @@ func loadPackages(modPath, modRoot, loadDir string, goModData, goSumData []byte)
 	// version, try loading in the release directory. Errors there would imply
 	// that packages don't load without replace / exclude directives.
 	cfg := &packages.Config{
-		Mode: packages.NeedName | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedImports | packages.NeedDeps,
 		Dir:  loadDir,
+		Env:  plat.environ(env),
 	}
 	if len(pkgPaths) > 0 {
 		pkgs, err = packages.Load(cfg, pkgPaths...)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	}
 
+	// Drop packages whose files are all excluded by build constraints on this
+	// platform, like a package with only _windows.go files on Linux. Such a
+	// package may still be listed if it has test files. It doesn't exist on
+	// this platform, and it shouldn't be reported with an error.
+	n := 0
+	for _, pkg := range pkgs {
+		if !isExcludedPackage(pkg) {
+			pkgs[n] = pkg
+			n++
+		}
+	}
+	pkgs = pkgs[:n]
+
 	// Sort the returned packages by path.
 	// packages.Load makes no guarantee about the order of returned packages.
 	sort.Slice(pkgs, func(i, j int) bool {
@@ -1017,101 +1513,156 @@ func loadPackages(modPath, modRoot, loadDir string, goModData, goSumData []byte)
 		}
 	}
 
-	// Report new requirements in go.mod.
-	goModPath := filepath.Join(loadDir, "go.mod")
-	loadReqs := func(data []byte) ([]string, error) {
-		modFile, err := modfile.ParseLax(goModPath, data, nil)
-		if err != nil {
-			return nil, err
-		}
-		lines := make([]string, len(modFile.Require))
-		for i, req := range modFile.Require {
-			lines[i] = req.Mod.String()
-		}
-		sort.Strings(lines)
-		return lines, nil
-	}
-
-	oldReqs, err := loadReqs(goModData)
-	if err != nil {
-		return nil, nil, err
-	}
-	newGoModData, err := ioutil.ReadFile(goModPath)
-	if err != nil {
-		return nil, nil, err
-	}
-	newReqs, err := loadReqs(newGoModData)
-	if err != nil {
-		return nil, nil, err
-	}
+	return pkgs, nil
+}
 
-	oldMap := make(map[string]bool)
-	for _, req := range oldReqs {
-		oldMap[req] = true
+// isExcludedPackage reports whether pkg has no Go files because build
+// constraints exclude all of them.
+func isExcludedPackage(pkg *packages.Package) bool {
+	if len(pkg.GoFiles) > 0 {
+		return false
 	}
-	var missing []string
-	for _, req := range newReqs {
-		if !oldMap[req] {
-			missing = append(missing, req)
+	for _, e := range pkg.Errors {
+		if !strings.Contains(e.Msg, "build constraints exclude all Go files") {
+			return false
 		}
 	}
+	return true
+}
 
-	if len(missing) > 0 {
-		diagnostics = append(diagnostics, fmt.Sprintf("go.mod: the following requirements are needed\n\t%s\nRun 'go mod tidy' to add missing requirements.", strings.Join(missing, "\n\t")))
-		return pkgs, diagnostics, nil
+// comparePackages compares the packages of the base and release versions
+// loaded for one platform and returns reports for the packages, sorted by
+// path relative to the module path.
+//
+// Internal packages are ignored, unless they are imported by nested modules.
+// If we don't have a base version to compare against, we just check the new
+// packages for errors.
+//
+// The packages are paired by their paths relative to the module paths and
+// compared together with apidiff.ModuleChanges, so that a type may move to
+// another package of the module, leaving an alias behind.
+func (r *report) comparePackages(basePkgs, releasePkgs []*packages.Package) []packageReport {
+	base, release := &r.base, &r.release
+	shouldCompare := base.version != "none"
+	importedBy := func(modPath, pkgPath string) []string {
+		return release.submoduleImports[path.Join(release.modPath, trimPathPrefix(pkgPath, modPath))]
+	}
+	isHidden := func(modPath, pkgPath string) bool {
+		return isInternal(modPath, pkgPath) && importedBy(modPath, pkgPath) == nil
+	}
+
+	baseModule := &apidiff.Module{Path: base.modPath}
+	releaseModule := &apidiff.Module{Path: release.modPath}
+	baseByRel := make(map[string]*packages.Package)
+	releaseByRel := make(map[string]*packages.Package)
+	var rels []string
+	for _, pkg := range basePkgs {
+		rel := baseModule.RelativePath(pkg.PkgPath)
+		baseByRel[rel] = pkg
+		rels = append(rels, rel)
+	}
+	for _, pkg := range releasePkgs {
+		rel := releaseModule.RelativePath(pkg.PkgPath)
+		if baseByRel[rel] == nil {
+			rels = append(rels, rel)
+		}
+		releaseByRel[rel] = pkg
 	}
+	sort.Strings(rels)
 
-	newGoSumData, err := ioutil.ReadFile(filepath.Join(loadDir, "go.sum"))
-	if err != nil && !os.IsNotExist(err) {
-		return nil, nil, err
-	}
-	if !bytes.Equal(goSumData, newGoSumData) {
-		diagnostics = append(diagnostics, "go.sum: one or more sums are missing.\nRun 'go mod tidy' to add missing sums.")
+	// Choose the packages to report on and the packages to compare.
+	var prs []*packageReport
+	byPath := make(map[string]*packageReport) // by base and release package path
+	compare := func(pr *packageReport, basePkg, releasePkg *packages.Package) {
+		if basePkg != nil {
+			baseModule.Packages = append(baseModule.Packages, basePkg.Types)
+			byPath[basePkg.PkgPath] = pr
+		}
+		if releasePkg != nil {
+			releaseModule.Packages = append(releaseModule.Packages, releasePkg.Types)
+			byPath[releasePkg.PkgPath] = pr
+		}
 	}
+	var pairs [][2]*packages.Package
+	for _, rel := range rels {
+		basePkg, releasePkg := baseByRel[rel], releaseByRel[rel]
+		switch {
+		case releasePkg == nil:
+			// Package removed
+			if internal := isHidden(base.modPath, basePkg.PkgPath); !internal || len(basePkg.Errors) > 0 {
+				pr := &packageReport{
+					path:       basePkg.PkgPath,
+					importedBy: importedBy(base.modPath, basePkg.PkgPath),
+					baseErrors: basePkg.Errors,
+				}
+				if !internal && shouldCompare {
+					compare(pr, basePkg, nil)
+				}
+				prs = append(prs, pr)
+			}
 
-	return pkgs, diagnostics, nil
-}
-
-type packagePair struct {
-	base, release *packages.Package
-}
+		case basePkg == nil:
+			// Package added
+			if internal := isHidden(release.modPath, releasePkg.PkgPath); !internal && shouldCompare || len(releasePkg.Errors) > 0 {
+				pr := &packageReport{
+					path:          releasePkg.PkgPath,
+					importedBy:    importedBy(release.modPath, releasePkg.PkgPath),
+					releaseErrors: releasePkg.Errors,
+				}
+				if !internal && shouldCompare {
+					// If we aren't comparing against a base version, don't say
+					// "package added". Only report packages with errors.
+					compare(pr, nil, releasePkg)
+				}
+				prs = append(prs, pr)
+			}
 
-// zipPackages combines two lists of packages, sorted by package path,
-// and returns a sorted list of pairs of packages with matching paths.
-// If a package is in one list but not the other (because it was added or
-// removed between releases), a pair will be returned with a nil
-// base or release field.
-func zipPackages(baseModPath string, basePkgs []*packages.Package, releaseModPath string, releasePkgs []*packages.Package) []packagePair {
-	baseIndex, releaseIndex := 0, 0
-	var pairs []packagePair
-	for baseIndex < len(basePkgs) || releaseIndex < len(releasePkgs) {
-		var basePkg, releasePkg *packages.Package
-		var baseSuffix, releaseSuffix string
-		if baseIndex < len(basePkgs) {
-			basePkg = basePkgs[baseIndex]
-			baseSuffix = trimPathPrefix(basePkg.PkgPath, baseModPath)
-		}
-		if releaseIndex < len(releasePkgs) {
-			releasePkg = releasePkgs[releaseIndex]
-			releaseSuffix = trimPathPrefix(releasePkg.PkgPath, releaseModPath)
+		default:
+			// Matched packages
+			// Both packages are internal or neither; we only consider path components
+			// after the module path.
+			internal := isHidden(release.modPath, releasePkg.PkgPath)
+			if !internal && basePkg.Name != "main" && releasePkg.Name != "main" {
+				pr := &packageReport{
+					path:          basePkg.PkgPath,
+					importedBy:    importedBy(release.modPath, releasePkg.PkgPath),
+					baseErrors:    basePkg.Errors,
+					releaseErrors: releasePkg.Errors,
+				}
+				compare(pr, basePkg, releasePkg)
+				pairs = append(pairs, [2]*packages.Package{basePkg, releasePkg})
+				prs = append(prs, pr)
+			}
 		}
+	}
 
-		var pair packagePair
-		if basePkg != nil && (releasePkg == nil || baseSuffix < releaseSuffix) {
-			// Package removed
-			pair = packagePair{basePkg, nil}
-			baseIndex++
-		} else if releasePkg != nil && (basePkg == nil || releaseSuffix < baseSuffix) {
-			// Package added
-			pair = packagePair{nil, releasePkg}
-			releaseIndex++
-		} else {
-			// Matched packages.
-			pair = packagePair{basePkg, releasePkg}
-			baseIndex++
-			releaseIndex++
+	if shouldCompare {
+		for _, c := range apidiff.ModuleChanges(baseModule, releaseModule).Changes {
+			if pr := byPath[c.Package]; pr != nil {
+				pr.Changes = append(pr.Changes, c)
+				continue
+			}
+			// A change to a type declared in a package that wasn't compared,
+			// like an internal package, is visible through the API of the
+			// compared packages that import it.
+			for _, pair := range pairs {
+				if findDependency(pair[0], c.Package) != nil || findDependency(pair[1], c.Package) != nil {
+					pr := byPath[pair[1].PkgPath]
+					pr.Changes = append(pr.Changes, c)
+				}
+			}
 		}
-		pairs = append(pairs, pair)
 	}
-	return pairs
+	// Changes to the APIs of upgraded or downgraded dependencies may be
+	// visible through the package's API.
+	for _, pair := range pairs {
+		pr := byPath[pair[1].PkgPath]
+		pr.Changes = append(pr.Changes, reexportedChanges(pair[0], pair[1], r.requirements)...)
+	}
+
+	reports := make([]packageReport, len(prs))
+	for i, pr := range prs {
+		reports[i] = *pr
+	}
+	return reports
 }
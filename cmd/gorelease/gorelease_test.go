@@ -108,6 +108,46 @@ type test struct {
 	// to pass to gorelease.
 	releaseVersion string
 
+	// platforms (set with platforms=...) is the value of the -platforms flag
+	// to pass to gorelease.
+	platforms string
+
+	// proxy (set with proxy=...) is the value of the -proxy flag to pass to
+	// gorelease.
+	proxy string
+
+	// submodules (set with submodules=...) is the value of the -submodules
+	// flag to pass to gorelease.
+	submodules string
+
+	// json (set with json=...) is true if gorelease should be invoked with
+	// -json, so that "want" holds a JSON report.
+	json bool
+
+	// notes (set with notes=...) is true if gorelease should be invoked with
+	// -notes, so that "want" holds release notes.
+	notes bool
+
+	// deprecations (set with deprecations=...) is true if gorelease should be
+	// invoked with -deprecations.
+	deprecations bool
+
+	// deprecationAge (set with deprecation-age=...) is the value of the
+	// -deprecation-age flag to pass to gorelease, if not empty.
+	deprecationAge string
+
+	// zip (set with zip=...) is true if gorelease should be invoked with
+	// -zip, so that "want" includes the module zip section.
+	zip bool
+
+	// tag (set with tag=...) is the value of the -tag flag to pass to
+	// gorelease.
+	tag string
+
+	// plan (set with plan=...) is true if gorelease should be invoked with
+	// -plan, so that "want" holds a release plan for the repository.
+	plan bool
+
 	// dir (set with dir=...) is the directory where gorelease should be invoked.
 	// If unset, gorelease is invoked in the directory where the txtar archive
 	// is unpacked. This is useful for invoking gorelease in a subdirectory.
@@ -168,6 +208,41 @@ func readTest(testPath string) (*test, error) {
 			t.releaseVersion = value
 		case "dir":
 			t.dir = value
+		case "platforms":
+			t.platforms = value
+		case "proxy":
+			t.proxy = value
+		case "submodules":
+			t.submodules = value
+		case "json":
+			t.json, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", testPath, lineNum, err)
+			}
+		case "notes":
+			t.notes, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", testPath, lineNum, err)
+			}
+		case "deprecations":
+			t.deprecations, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", testPath, lineNum, err)
+			}
+		case "deprecation-age":
+			t.deprecationAge = value
+		case "zip":
+			t.zip, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", testPath, lineNum, err)
+			}
+		case "tag":
+			t.tag = value
+		case "plan":
+			t.plan, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", testPath, lineNum, err)
+			}
 		case "skip":
 			t.skip = value
 		case "success":
@@ -184,7 +259,7 @@ func readTest(testPath string) (*test, error) {
 			return nil, fmt.Errorf("%s:%d: unknown key: %q", testPath, lineNum, key)
 		}
 	}
-	if t.modPath == "" && (t.version != "" || (t.baseVersion != "" && t.baseVersion != "none")) {
+	if t.modPath == "" && (t.version != "" || (t.baseVersion != "" && t.baseVersion != "none" && !strings.HasPrefix(t.baseVersion, "dir:"))) {
 		return nil, fmt.Errorf("%s: version or base was set but mod was not set", testPath)
 	}
 
@@ -284,6 +359,36 @@ func TestRelease(t *testing.T) {
 			if test.releaseVersion != "" {
 				args = append(args, "-version="+test.releaseVersion)
 			}
+			if test.platforms != "" {
+				args = append(args, "-platforms="+test.platforms)
+			}
+			if test.proxy != "" {
+				args = append(args, "-proxy="+test.proxy)
+			}
+			if test.submodules != "" {
+				args = append(args, "-submodules="+test.submodules)
+			}
+			if test.json {
+				args = append(args, "-json")
+			}
+			if test.notes {
+				args = append(args, "-notes")
+			}
+			if test.deprecations {
+				args = append(args, "-deprecations")
+			}
+			if test.deprecationAge != "" {
+				args = append(args, "-deprecation-age="+test.deprecationAge)
+			}
+			if test.zip {
+				args = append(args, "-zip")
+			}
+			if test.tag != "" {
+				args = append(args, "-tag="+test.tag)
+			}
+			if test.plan {
+				args = append(args, "-plan")
+			}
 			buf := &bytes.Buffer{}
 			releaseDir := filepath.Join(testDir, test.dir)
 			success, err := runRelease(buf, releaseDir, args)
@@ -0,0 +1,297 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/zip"
+)
+
+// maxZipDirs is the number of directories listed in the size section of a
+// zipReport, largest first.
+const maxZipDirs = 5
+
+// A zipReport describes the module zip file that would be created for the
+// release version: which files it would include, how large they are, and
+// whether it has a license.
+type zipReport struct {
+	// files and size are the number and total size of the included files.
+	files int
+	size  int64
+
+	// dirs lists the largest directories, by the total size of the files
+	// directly in each, up to maxZipDirs.
+	dirs []zipDirSize
+
+	// omitted lists files and directories that are left out of the zip, like
+	// vendor directories and nested modules. invalid lists files that can't
+	// be included, such as files with invalid names, which prevent the zip
+	// from being created.
+	omitted, invalid []zip.FileError
+
+	// sizeError is set if the files exceed the size limit for module zips.
+	sizeError error
+
+	// license is the file path of the LICENSE file included in the zip, or
+	// "" if there is none. licenseFromRepo is true if the file is at the
+	// root of the repository, since the module has no LICENSE of its own.
+	license         string
+	licenseFromRepo bool
+}
+
+// A zipDirSize is the total size of the files directly in a directory of a
+// module, which is slash-separated and relative to the module root.
+type zipDirSize struct {
+	dir  string
+	size int64
+}
+
+// checkModuleZip reports on the module zip file for the module in modRoot,
+// which is in the repository in repoRoot, or in no repository if repoRoot is
+// "". Like the go command, it includes the LICENSE file at the repository
+// root if the module is in a subdirectory without its own.
+func checkModuleZip(modRoot, repoRoot string) (*zipReport, error) {
+	cf, err := zip.CheckDir(modRoot)
+	if err != nil && cf.Err() == nil {
+		// An I/O error; other errors are described by cf.
+		return nil, err
+	}
+	// CheckDir returns file paths. Report paths relative to the module root,
+	// as in the zip file.
+	relPath := func(p string) string {
+		if rel, err := filepath.Rel(modRoot, p); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return p
+	}
+	zr := &zipReport{sizeError: cf.SizeError}
+	for _, fe := range cf.Invalid {
+		zr.invalid = append(zr.invalid, zip.FileError{Path: relPath(fe.Path), Err: fe.Err})
+	}
+
+	dirSizes := make(map[string]int64)
+	addFile := func(dir string, size int64) {
+		zr.files++
+		zr.size += size
+		dirSizes[dir] += size
+	}
+	for _, p := range cf.Valid {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return nil, err
+		}
+		rel := relPath(p)
+		addFile(path.Dir(rel), fi.Size())
+		if rel == "LICENSE" {
+			zr.license = p
+		}
+	}
+	if zr.license == "" && repoRoot != "" && modRoot != repoRoot {
+		license := filepath.Join(repoRoot, "LICENSE")
+		if fi, err := os.Stat(license); err == nil && fi.Mode().IsRegular() {
+			addFile(".", fi.Size())
+			zr.license, zr.licenseFromRepo = license, true
+		}
+	}
+
+	for dir, size := range dirSizes {
+		zr.dirs = append(zr.dirs, zipDirSize{dir: dir, size: size})
+	}
+	sort.Slice(zr.dirs, func(i, j int) bool {
+		if zr.dirs[i].size != zr.dirs[j].size {
+			return zr.dirs[i].size > zr.dirs[j].size
+		}
+		return zr.dirs[i].dir < zr.dirs[j].dir
+	})
+	if len(zr.dirs) > maxZipDirs {
+		zr.dirs = zr.dirs[:maxZipDirs]
+	}
+
+	// Files in vendor directories are omitted one by one; list each vendor
+	// directory once instead. Version control directories are always
+	// omitted and not worth listing.
+	seenVendor := make(map[string]bool)
+	for _, fe := range cf.Omitted {
+		fe.Path = relPath(fe.Path)
+		if isVCSDir(path.Base(fe.Path)) {
+			continue
+		}
+		if i := strings.Index("/"+fe.Path, "/vendor/"); i >= 0 {
+			dir := fe.Path[:i+len("vendor")]
+			if !seenVendor[dir] {
+				seenVendor[dir] = true
+				zr.omitted = append(zr.omitted, zip.FileError{Path: dir, Err: fmt.Errorf("vendor directory")})
+			}
+			continue
+		}
+		zr.omitted = append(zr.omitted, fe)
+	}
+	sort.Slice(zr.omitted, func(i, j int) bool { return zr.omitted[i].Path < zr.omitted[j].Path })
+	return zr, nil
+}
+
+// isVCSDir reports whether name is the name of a version control directory,
+// as recognized by findRepoRoot.
+func isVCSDir(name string) bool {
+	switch name {
+	case ".git", ".hg", ".svn", ".bzr":
+		return true
+	}
+	return false
+}
+
+// isValid reports whether a module zip file can be created.
+func (zr *zipReport) isValid() bool {
+	return len(zr.invalid) == 0 && zr.sizeError == nil
+}
+
+// Text writes the zip report as a section of a report.
+func (zr *zipReport) Text(buf *bytes.Buffer) {
+	fmt.Fprintln(buf, "Module zip:")
+	fmt.Fprintf(buf, "- Total size: %s in %d files (limit %s)\n", formatSize(zr.size), zr.files, formatSize(zip.MaxZipFile))
+	if zr.sizeError != nil {
+		fmt.Fprintf(buf, "  %v\n", zr.sizeError)
+	}
+	if len(zr.dirs) > 0 {
+		fmt.Fprintln(buf, "- Largest directories:")
+		for _, d := range zr.dirs {
+			fmt.Fprintf(buf, "  - %s: %s\n", d.dir, formatSize(d.size))
+		}
+	}
+	if len(zr.omitted) > 0 {
+		fmt.Fprintln(buf, "- Excluded:")
+		for _, fe := range zr.omitted {
+			fmt.Fprintf(buf, "  - %s: %v\n", fe.Path, fe.Err)
+		}
+	}
+	if len(zr.invalid) > 0 {
+		fmt.Fprintln(buf, "- Invalid:")
+		for _, fe := range zr.invalid {
+			fmt.Fprintf(buf, "  - %s: %v\n", fe.Path, fe.Err)
+		}
+	}
+	switch {
+	case zr.licenseFromRepo:
+		fmt.Fprintln(buf, "- License: LICENSE from the repository root directory")
+	case zr.license != "":
+		fmt.Fprintln(buf, "- License: LICENSE")
+	default:
+		fmt.Fprintln(buf, "- License: none")
+	}
+	buf.WriteByte('\n')
+}
+
+// jsonZip describes the module zip file in a jsonReport.
+type jsonZip struct {
+	// Files and Size are the number and total size in bytes of the files
+	// included in the zip. MaxSize is the limit for Size.
+	Files   int
+	Size    int64
+	MaxSize int64
+
+	// SizeError is set if Size exceeds MaxSize.
+	SizeError string `json:",omitempty"`
+
+	// Directories lists the largest directories, by the total size of the
+	// files directly in each.
+	Directories []jsonZipDir `json:",omitempty"`
+
+	// Excluded lists files and directories left out of the zip, like vendor
+	// directories and nested modules. Invalid lists files that prevent the
+	// zip from being created, like files with invalid names.
+	Excluded []jsonZipFile `json:",omitempty"`
+	Invalid  []jsonZipFile `json:",omitempty"`
+
+	// License is true if the zip includes a LICENSE file. LicenseFromRepo
+	// is true if the file is taken from the root of the repository, since
+	// the module has no LICENSE of its own.
+	License         bool
+	LicenseFromRepo bool `json:",omitempty"`
+}
+
+type jsonZipDir struct {
+	Path string
+	Size int64
+}
+
+type jsonZipFile struct {
+	Path, Reason string
+}
+
+func (zr *zipReport) jsonZip() *jsonZip {
+	jz := &jsonZip{
+		Files:           zr.files,
+		Size:            zr.size,
+		MaxSize:         zip.MaxZipFile,
+		License:         zr.license != "",
+		LicenseFromRepo: zr.licenseFromRepo,
+	}
+	if zr.sizeError != nil {
+		jz.SizeError = zr.sizeError.Error()
+	}
+	for _, d := range zr.dirs {
+		jz.Directories = append(jz.Directories, jsonZipDir{Path: d.dir, Size: d.size})
+	}
+	for _, fe := range zr.omitted {
+		jz.Excluded = append(jz.Excluded, jsonZipFile{Path: fe.Path, Reason: fe.Err.Error()})
+	}
+	for _, fe := range zr.invalid {
+		jz.Invalid = append(jz.Invalid, jsonZipFile{Path: fe.Path, Reason: fe.Err.Error()})
+	}
+	return jz
+}
+
+// formatSize formats a size in bytes for humans.
+func formatSize(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d B", n)
+	case n < 1<<20:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/(1<<10)), ".0") + " KiB"
+	default:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/(1<<20)), ".0") + " MiB"
+	}
+}
+
+// checkLicense adds warnings to the report if the release version has no
+// LICENSE file, or if its LICENSE file differs from the base version's.
+// The base version's LICENSE is read from its directory in the module cache
+// or from the base directory.
+func (r *report) checkLicense() error {
+	if r.zip.license == "" {
+		r.release.warnings = append(r.release.warnings, "The module has no LICENSE file. Without a license, others may not be allowed to use it.")
+	}
+	if r.base.version == "none" || r.base.modRoot == "" {
+		return nil
+	}
+	baseData, err := ioutil.ReadFile(filepath.Join(r.base.modRoot, "LICENSE"))
+	if os.IsNotExist(err) {
+		// The license was added or is still missing; neither needs a warning
+		// beyond the one above.
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if r.zip.license == "" {
+		r.release.warnings = append(r.release.warnings, fmt.Sprintf("The LICENSE file was removed since the base version (%s).", r.base.version))
+		return nil
+	}
+	releaseData, err := ioutil.ReadFile(r.zip.license)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(baseData, releaseData) {
+		r.release.warnings = append(r.release.warnings, fmt.Sprintf("The LICENSE file changed since the base version (%s). Users may need to review the new license.", r.base.version))
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/apidiff"
+)
+
+// Notes writes release notes for the release version to w, as a Markdown
+// section headed by the version. The section lists the incompatible and
+// compatible changes to the module's API, the APIs that were deprecated, and
+// the changes to the module's requirements. If commits is not empty, the
+// section also lists them; see report.commits. Characters in the changes,
+// requirements and commit subjects that Markdown could interpret, like the
+// asterisk of a pointer receiver, are escaped.
+//
+// If the release version is not known or not valid, the section is headed
+// "Unreleased".
+func (r *report) Notes(w io.Writer, commits []string) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "## %s\n", r.notesVersion())
+
+	empty := true
+	section := func(title string) {
+		fmt.Fprintf(buf, "\n### %s\n\n", title)
+		empty = false
+	}
+	changes := func(title string, compatible bool) {
+		wroteTitle := false
+		for _, p := range r.packages {
+			if len(p.importedBy) > 0 {
+				// Internal packages aren't part of the API users see.
+				continue
+			}
+			var msgs []string
+			for _, c := range p.Changes {
+				if c.Compatible == compatible {
+					msgs = append(msgs, c.Message)
+				}
+			}
+			if len(msgs) == 0 {
+				continue
+			}
+			if !wroteTitle {
+				section(title)
+				wroteTitle = true
+			}
+			writeNotesList(buf, p.path, msgs)
+		}
+	}
+	changes("Breaking changes", false)
+	changes("New APIs", true)
+
+	if deprecated := r.newlyDeprecated(); len(deprecated) > 0 {
+		section("Deprecations")
+		pkgPaths := make([]string, 0, len(deprecated))
+		for pkgPath := range deprecated {
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+		sort.Strings(pkgPaths)
+		for _, pkgPath := range pkgPaths {
+			writeNotesList(buf, pkgPath, deprecated[pkgPath])
+		}
+	}
+
+	if len(r.requirements) > 0 {
+		section("Dependency changes")
+		for _, c := range r.requirements {
+			fmt.Fprintf(buf, "- %s\n", apidiff.MarkdownEscape(c.summary()))
+		}
+	}
+
+	if len(commits) > 0 {
+		section("Commits")
+		for _, c := range commits {
+			fmt.Fprintf(buf, "- %s\n", apidiff.MarkdownEscape(c))
+		}
+	}
+
+	if empty {
+		fmt.Fprintf(buf, "\nNo changes to the API or requirements.\n")
+	}
+	_, err := io.Copy(w, buf)
+	return err
+}
+
+// writeNotes writes the release notes for r to w. If commits is true, the
+// notes list the commits since the base version. If changelog is not "", the
+// notes are also added to that changelog file, relative to dir.
+func writeNotes(w io.Writer, r *report, commits bool, changelog, dir string) error {
+	var commitList []string
+	if commits {
+		var err error
+		if commitList, err = r.commits(); err != nil {
+			return err
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err := r.Notes(buf, commitList); err != nil {
+		return err
+	}
+	if changelog != "" {
+		if !filepath.IsAbs(changelog) {
+			changelog = filepath.Join(dir, changelog)
+		}
+		if err := updateChangelog(changelog, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(w, buf)
+	return err
+}
+
+// notesVersion returns the version that heads the release notes.
+func (r *report) notesVersion() string {
+	if r.release.version == "" || r.versionInvalid != nil || len(r.release.diagnostics) > 0 {
+		return "Unreleased"
+	}
+	return r.release.version
+}
+
+// writeNotesList writes a Markdown list item for the package pkgPath with a
+// nested list of items, which are escaped like the changes written by
+// apidiff.MarkdownRenderer.
+func writeNotesList(buf *bytes.Buffer, pkgPath string, items []string) {
+	fmt.Fprintf(buf, "- `%s`\n", pkgPath)
+	for _, item := range items {
+		fmt.Fprintf(buf, "  - %s\n", apidiff.MarkdownEscape(item))
+	}
+}
+
+// newlyDeprecated returns the objects that are deprecated in the release
+// version but weren't in the base version, as a map from package path to
+// sorted object names. Internal packages are not included. It returns an
+// empty map if there is no base version.
+func (r *report) newlyDeprecated() map[string][]string {
+	m := make(map[string][]string)
+	if r.base.version == "none" {
+		return m
+	}
+	for pkgPath, names := range r.release.deprecated {
+		if isInternal(r.release.modPath, pkgPath) {
+			continue
+		}
+		basePkgPath := path.Join(r.base.modPath, trimPathPrefix(pkgPath, r.release.modPath))
+		for name := range names {
+			if !r.base.deprecated[basePkgPath][name] {
+				m[pkgPath] = append(m[pkgPath], name)
+			}
+		}
+		sort.Strings(m[pkgPath])
+	}
+	for pkgPath, names := range m {
+		if len(names) == 0 {
+			delete(m, pkgPath)
+		}
+	}
+	return m
+}
+
+// commits returns the subjects and abbreviated hashes of the commits that
+// changed files in the release version's module directory since the tag for
+// the base version, most recent first. If there is no base version, all
+// commits are returned. The repository must be a git repository.
+func (r *report) commits() ([]string, error) {
+	repoRoot, modRoot := r.release.repoRoot, r.release.modRoot
+	if repoRoot == "" {
+		return nil, fmt.Errorf("can't list commits: module is not in a repository")
+	}
+	args := []string{"log", "--format=%s (%h)"}
+	if r.base.version != "none" {
+		if r.base.modPath != r.release.modPath {
+			return nil, fmt.Errorf("can't list commits: base version is a different module, %s", r.base.modPath)
+		}
+		tag := r.release.tagPrefix + r.base.version
+		if _, err := runGit(repoRoot, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag); err != nil {
+			return nil, fmt.Errorf("can't list commits: tag %s not found", tag)
+		}
+		args = append(args, tag+"..HEAD")
+	}
+	args = append(args, "--", modRoot)
+	out, err := runGit(repoRoot, args...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			commits = append(commits, line)
+		}
+	}
+	return commits, nil
+}
+
+// runGit runs git with the given arguments in dir and returns its output.
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", cleanCmdError(err)
+	}
+	return string(out), nil
+}
+
+// updateChangelog adds notes, written by report.Notes, to the changelog file
+// at filename. The notes are inserted before the first section with a
+// level-two heading, which usually describes the latest version, or are
+// appended if there is no such section. The file is created if it doesn't
+// exist. It's an error if the changelog already has a section with the same
+// heading as the notes.
+func updateChangelog(filename string, notes []byte) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	heading := string(notes)
+	if i := strings.IndexByte(heading, '\n'); i >= 0 {
+		heading = heading[:i]
+	}
+
+	insert := len(data)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	offset := 0
+	for _, line := range lines {
+		l := strings.TrimRight(string(line), "\r\n")
+		if l == heading {
+			return fmt.Errorf("%s already has a section %q", filename, heading)
+		}
+		if strings.HasPrefix(l, "## ") && insert == len(data) {
+			insert = offset
+		}
+		offset += len(line)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(data[:insert])
+	if insert > 0 && !bytes.HasSuffix(data[:insert], []byte("\n\n")) {
+		if !bytes.HasSuffix(data[:insert], []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		buf.WriteByte('\n')
+	}
+	buf.Write(notes)
+	if insert < len(data) {
+		buf.WriteByte('\n')
+		buf.Write(data[insert:])
+	}
+	return ioutil.WriteFile(filename, buf.Bytes(), 0666)
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/exp/apidiff"
+)
+
+// initGitRepo creates a git repository in a temporary directory and returns
+// the directory. The test is skipped if git is not installed.
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, dir, "init", "--quiet")
+	gitT(t, dir, "config", "user.name", "gorelease")
+	gitT(t, dir, "config", "user.email", "gorelease@example.com")
+	gitT(t, dir, "config", "commit.gpgSign", "false")
+	gitT(t, dir, "config", "tag.gpgSign", "false")
+	return dir
+}
+
+// gitCommit writes files, a map from slash-separated paths relative to dir
+// to their contents, and commits them to the repository in dir.
+func gitCommit(t *testing.T, dir, msg string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "--quiet", "-m", msg)
+}
+
+// gitT runs git with the given arguments in dir and returns its output. The
+// test fails if git fails.
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return out
+}
+
+func TestCommits(t *testing.T) {
+	repo := initGitRepo(t)
+	gitCommit(t, repo, "add sub", map[string]string{
+		"sub/go.mod": "module example.com/repo/sub\n\ngo 1.12\n",
+	})
+	gitT(t, repo, "tag", "sub/v1.0.0")
+	gitCommit(t, repo, "add README", map[string]string{
+		"README": "not in the module\n",
+	})
+	gitCommit(t, repo, "add p", map[string]string{
+		"sub/p/p.go": "package p\n",
+	})
+
+	newReport := func(baseModPath, baseVersion string) *report {
+		return &report{
+			base: moduleInfo{modPath: baseModPath, version: baseVersion},
+			release: moduleInfo{
+				modPath:   "example.com/repo/sub",
+				repoRoot:  repo,
+				modRoot:   filepath.Join(repo, "sub"),
+				tagPrefix: "sub/",
+			},
+		}
+	}
+	// subjects trims the abbreviated hashes from commits.
+	subjects := func(commits []string) []string {
+		var s []string
+		for _, c := range commits {
+			i := strings.LastIndex(c, " (")
+			if i < 0 || !strings.HasSuffix(c, ")") {
+				t.Fatalf("commit %q does not end with an abbreviated hash", c)
+			}
+			s = append(s, c[:i])
+		}
+		return s
+	}
+
+	for _, test := range []struct {
+		desc, baseModPath, baseVersion string
+		want                           []string
+		wantErr                        string
+	}{
+		{
+			desc:        "since_base",
+			baseModPath: "example.com/repo/sub",
+			baseVersion: "v1.0.0",
+			want:        []string{"add p"},
+		}, {
+			desc:        "no_base",
+			baseModPath: "example.com/repo/sub",
+			baseVersion: "none",
+			want:        []string{"add p", "add sub"},
+		}, {
+			desc:        "missing_tag",
+			baseModPath: "example.com/repo/sub",
+			baseVersion: "v0.9.0",
+			wantErr:     "can't list commits: tag sub/v0.9.0 not found",
+		}, {
+			desc:        "other_module",
+			baseModPath: "example.com/other",
+			baseVersion: "v1.0.0",
+			wantErr:     "can't list commits: base version is a different module, example.com/other",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			commits, err := newReport(test.baseModPath, test.baseVersion).commits()
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Fatalf("got error %v; want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := subjects(commits); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got commits %q; want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCommitsNoRepository(t *testing.T) {
+	r := &report{base: moduleInfo{version: "none"}}
+	if _, err := r.commits(); err == nil || !strings.Contains(err.Error(), "not in a repository") {
+		t.Errorf("got error %v; want an error about the missing repository", err)
+	}
+}
+
+func TestNotesEscape(t *testing.T) {
+	r := &report{
+		base: moduleInfo{modPath: "example.com/m", version: "v1.0.0"},
+		release: moduleInfo{
+			modPath:    "example.com/m",
+			version:    "v1.1.0",
+			deprecated: map[string]map[string]bool{"example.com/m": {"Old_T": true}},
+		},
+		packages: []packageReport{{
+			path: "example.com/m",
+			Report: apidiff.Report{Changes: []apidiff.Change{
+				{Message: "(*T).M: added", Compatible: true},
+			}},
+		}},
+		requirements: []*requirementChange{{path: "example.com/a_b", release: "v1.0.0"}},
+	}
+	buf := &bytes.Buffer{}
+	if err := r.Notes(buf, []string{"Fix *T in [p] (abc1234)"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "## v1.1.0\n" +
+		"\n### New APIs\n\n" +
+		"- `example.com/m`\n" +
+		"  - (\\*T).M: added\n" +
+		"\n### Deprecations\n\n" +
+		"- `example.com/m`\n" +
+		"  - Old\\_T\n" +
+		"\n### Dependency changes\n\n" +
+		"- example.com/a\\_b: added at v1.0.0\n" +
+		"\n### Commits\n\n" +
+		"- Fix \\*T in \\[p\\] (abc1234)\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got notes:\n%s\nwant:\n%s", got, want)
+	}
+}
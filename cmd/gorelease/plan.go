@@ -0,0 +1,406 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// A repository may contain several modules that require each other. Releasing
+// them takes a plan: a module must be released after the modules it requires,
+// and a module that uses new APIs of another must require the version that
+// adds them.
+
+// A planModule is a module in a release plan.
+type planModule struct {
+	// dir is the module root directory, relative to the repository root
+	// and slash-separated, or "." for the repository root.
+	dir string
+
+	// report compares the module in the repository with its latest release.
+	report report
+
+	// since caches reports comparing the module in the repository with
+	// older versions required by other modules, keyed by version. See
+	// reportSince.
+	since map[string]*report
+
+	// requires lists the paths of the other modules in the plan that the
+	// module requires.
+	requires []string
+
+	// upgrades lists the requirements on other modules in the plan that must
+	// be upgraded.
+	upgrades []planUpgrade
+}
+
+// A planUpgrade describes a requirement on a module in the plan that must be
+// upgraded, since the requiring module uses APIs added after the required
+// version.
+type planUpgrade struct {
+	path string
+
+	// from is the required version, and to is the version to upgrade to:
+	// the latest release, if it has all the APIs used, or else the new
+	// version, or "" if no version could be suggested for the module.
+	from, to string
+
+	// uses lists the new APIs that are used, as package-qualified names like
+	// "example.com/mod/pkg.Func", or package paths for new packages.
+	uses []string
+}
+
+// runPlan makes a release plan for all modules in the repository containing
+// dir and writes it to w. Each module is compared with its latest release,
+// as gorelease does when run in the module's directory without flags.
+//
+// plats lists the platforms for which packages are loaded, and env is the
+// environment for go commands.
+func runPlan(w io.Writer, dir string, plats []platform, env []string) (success bool, err error) {
+	repoRoot := findRepoRoot(dir)
+	if repoRoot == "" {
+		return false, fmt.Errorf("can't make a release plan: %s is not in a repository", dir)
+	}
+	modRoots, err := findSubmoduleDirs(repoRoot)
+	if err != nil {
+		return false, err
+	}
+	if fi, err := os.Stat(filepath.Join(repoRoot, "go.mod")); err == nil && !fi.IsDir() {
+		modRoots = append([]string{repoRoot}, modRoots...)
+	}
+	if len(modRoots) == 0 {
+		return false, fmt.Errorf("can't make a release plan: no modules found in %s", repoRoot)
+	}
+
+	// Modules are loaded with the other modules in the repository replaced by
+	// their directories, since a module may already use APIs of another that
+	// haven't been released yet.
+	byPath := make(map[string]*planModule)
+	var paths []string
+	dirs := make(map[string]string)
+	for _, modRoot := range modRoots {
+		rel, err := filepath.Rel(repoRoot, modRoot)
+		if err != nil {
+			return false, err
+		}
+		m := &planModule{dir: filepath.ToSlash(rel)}
+		data, err := ioutil.ReadFile(filepath.Join(modRoot, "go.mod"))
+		if err != nil {
+			return false, err
+		}
+		modPath := modfile.ModulePath(data)
+		if modPath == "" {
+			return false, fmt.Errorf("%s: go.mod: module directive is missing", m.dir)
+		}
+		if other := byPath[modPath]; other != nil {
+			return false, fmt.Errorf("can't make a release plan: module %s is defined in %s and %s", modPath, other.dir, m.dir)
+		}
+		byPath[modPath] = m
+		paths = append(paths, modPath)
+		dirs[modPath] = modRoot
+	}
+	sort.Strings(paths)
+	for _, modPath := range paths {
+		m := byPath[modPath]
+		replace := make(map[string]string)
+		for otherPath, dir := range dirs {
+			if otherPath != modPath {
+				replace[otherPath] = dir
+			}
+		}
+		var err error
+		if m.report, err = planReport(dirs[modPath], repoRoot, replace, plats, env); err != nil {
+			return false, fmt.Errorf("%s: %v", m.dir, err)
+		}
+	}
+
+	for _, modPath := range paths {
+		m := byPath[modPath]
+		for _, req := range m.report.release.goModFile.Require {
+			dep := byPath[req.Mod.Path]
+			if dep == nil {
+				continue
+			}
+			m.requires = append(m.requires, req.Mod.Path)
+			depReport, err := dep.reportSince(req.Mod.Version, plats, env)
+			if err != nil {
+				return false, fmt.Errorf("%s: %v", dep.dir, err)
+			}
+			uses, err := newAPIUses(m.report.release.modRoot, depReport)
+			if err != nil {
+				return false, err
+			}
+			if len(uses) == 0 {
+				continue
+			}
+			// If the APIs were added before the latest release, requiring
+			// that release is enough.
+			to := ""
+			if depReport != &dep.report {
+				unreleased, err := newAPIUses(m.report.release.modRoot, &dep.report)
+				if err != nil {
+					return false, err
+				}
+				if len(unreleased) == 0 {
+					to = dep.report.base.version
+				}
+			}
+			if to == "" && dep.report.versionInvalid == nil {
+				to = dep.report.release.version
+			}
+			if to != "" && semver.Compare(req.Mod.Version, to) >= 0 {
+				continue
+			}
+			m.upgrades = append(m.upgrades, planUpgrade{path: req.Mod.Path, from: req.Mod.Version, to: to, uses: uses})
+		}
+	}
+
+	order, cycle := planOrder(paths, byPath)
+
+	buf := &bytes.Buffer{}
+	success = true
+	fmt.Fprintf(buf, "Modules, in the order they should be released:\n")
+	for i, modPath := range order {
+		m := byPath[modPath]
+		fmt.Fprintf(buf, "\n")
+		m.text(buf, i+1)
+		if !m.report.isSuccessful() || len(m.upgrades) > 0 {
+			success = false
+		}
+	}
+	if len(cycle) > 0 {
+		success = false
+		fmt.Fprintf(buf, "\nThese modules require each other, so they can't be released in order:\n")
+		for _, modPath := range cycle {
+			fmt.Fprintf(buf, "\t%s\n", modPath)
+		}
+	}
+	if _, err := io.Copy(w, buf); err != nil {
+		return false, err
+	}
+	return success, nil
+}
+
+// planReport compares the module in modRoot with its latest release. The
+// modules in replace are loaded from their directories, as described in
+// loadLocalModule.
+func planReport(modRoot, repoRoot string, replace map[string]string, plats []platform, env []string) (report, error) {
+	release, err := loadLocalModule(modRoot, repoRoot, "", replace, plats, env)
+	if err != nil {
+		return report{}, err
+	}
+	if release.submoduleImports, err = findSubmoduleImports(modRoot, release.modPath, "auto"); err != nil {
+		return report{}, err
+	}
+	base, err := loadDownloadedModule(release.modPath, "", "", plats, env)
+	if err != nil {
+		return report{}, err
+	}
+	return makeReleaseReport(base, release)
+}
+
+// reportSince returns a report comparing the module in the repository with
+// version, a version of the module required by another module in the plan.
+// If version is the latest release, or if it can't be downloaded, as when
+// it's a placeholder for a module that is only replaced, the report is
+// m.report.
+func (m *planModule) reportSince(version string, plats []platform, env []string) (*report, error) {
+	if version == m.report.base.version {
+		return &m.report, nil
+	}
+	if r, ok := m.since[version]; ok {
+		return r, nil
+	}
+	r := &m.report
+	if base, err := loadDownloadedModule(m.report.release.modPath, version, "", plats, env); err == nil {
+		release := m.report.release
+		release.version, release.versionInferred = "", false
+		rep, err := makeReleaseReport(base, release)
+		if err != nil {
+			return nil, err
+		}
+		r = &rep
+	}
+	if m.since == nil {
+		m.since = make(map[string]*report)
+	}
+	m.since[version] = r
+	return r, nil
+}
+
+// planOrder sorts the module paths so that each module comes after the
+// modules it requires. Modules that are sorted equally come in path order.
+// Modules in requirement cycles come last, and are also returned in cycle.
+func planOrder(paths []string, byPath map[string]*planModule) (order, cycle []string) {
+	done := make(map[string]bool)
+	for len(order) < len(paths) {
+		var ready []string
+		for _, modPath := range paths {
+			if done[modPath] {
+				continue
+			}
+			isReady := true
+			for _, req := range byPath[modPath].requires {
+				if !done[req] && req != modPath {
+					isReady = false
+					break
+				}
+			}
+			if isReady {
+				ready = append(ready, modPath)
+			}
+		}
+		if len(ready) == 0 {
+			for _, modPath := range paths {
+				if !done[modPath] {
+					cycle = append(cycle, modPath)
+				}
+			}
+			return append(order, cycle...), cycle
+		}
+		for _, modPath := range ready {
+			done[modPath] = true
+		}
+		order = append(order, ready...)
+	}
+	return order, nil
+}
+
+// text writes a description of the module as the nth item of a release plan.
+func (m *planModule) text(buf *bytes.Buffer, n int) {
+	r := &m.report
+	where := "in " + m.dir + "/"
+	if m.dir == "." {
+		where = "in the repository root directory"
+	}
+	fmt.Fprintf(buf, "%d. %s %s\n", n, r.release.modPath, where)
+	indent := strings.Repeat(" ", len(strconv.Itoa(n))+2)
+	fmt.Fprintf(buf, "%sBase version: %s\n", indent, r.base.version)
+	for _, d := range r.release.diagnostics {
+		fmt.Fprintf(buf, "%s%s\n", indent, strings.ReplaceAll(d, "\n", "\n"+indent))
+	}
+	for _, p := range r.packages {
+		if len(p.releaseErrors) == 0 {
+			continue
+		}
+		fmt.Fprintf(buf, "%sErrors in package %s:\n", indent, p.path)
+		for _, e := range p.releaseErrors {
+			fmt.Fprintf(buf, "%s- %v\n", indent, e)
+		}
+	}
+	switch {
+	case r.versionInvalid != nil:
+		fmt.Fprintf(buf, "%s%s %s\n", indent, r.versionInvalid.message, strings.ReplaceAll(r.versionInvalid.reason, "\n", " "))
+	case r.release.tagPrefix == "":
+		fmt.Fprintf(buf, "%sSuggested version: %s\n", indent, r.release.version)
+	default:
+		fmt.Fprintf(buf, "%sSuggested version: %[2]s (with tag %[3]s%[2]s)\n", indent, r.release.version, r.release.tagPrefix)
+	}
+	for _, u := range m.upgrades {
+		to := u.to
+		if to == "" {
+			to = "its next version"
+		}
+		fmt.Fprintf(buf, "%sRequirement %s %s must be upgraded to %s to use:\n", indent, u.path, u.from, to)
+		for _, use := range u.uses {
+			fmt.Fprintf(buf, "%s- %s\n", indent, use)
+		}
+	}
+}
+
+// newAPIUses returns the APIs that were added to a module since the base
+// version of depReport, and that are used by the Go files of the module in
+// modRoot. Each API is a package-qualified name like
+// "example.com/mod/pkg.Func", or a package path for a new package.
+//
+// Files are only parsed, not type-checked, so new methods and struct fields
+// are not detected, only new package-level objects referred to as pkg.Name.
+func newAPIUses(modRoot string, depReport *report) ([]string, error) {
+	newPkgs := make(map[string]bool)
+	added := make(map[string]map[string]bool)
+	for _, p := range depReport.packages {
+		for _, c := range p.Changes {
+			switch {
+			case c.Message == "package added":
+				newPkgs[p.path] = true
+			case c.Kind == apidiff.Added && c.Part == "" && token.IsIdentifier(c.Object):
+				if added[p.path] == nil {
+					added[p.path] = make(map[string]bool)
+				}
+				added[p.path][c.Object] = true
+			}
+		}
+	}
+	if len(newPkgs) == 0 && len(added) == 0 {
+		return nil, nil
+	}
+	pkgNames := make(map[string]string)
+	for _, pkg := range depReport.release.pkgs {
+		pkgNames[pkg.PkgPath] = pkg.Name
+	}
+
+	seen := make(map[string]bool)
+	var uses []string
+	use := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			uses = append(uses, s)
+		}
+	}
+	err := parseModuleFiles(modRoot, 0, func(_ string, f *ast.File) {
+		imports := make(map[string]string) // local package name to path
+		for _, spec := range f.Imports {
+			pkgPath, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if newPkgs[pkgPath] {
+				use(pkgPath)
+			}
+			if added[pkgPath] == nil {
+				continue
+			}
+			name := pkgNames[pkgPath]
+			if name == "" {
+				name = path.Base(pkgPath)
+			}
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			imports[name] = pkgPath
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			// Package names are not resolved by the parser; local variables
+			// that shadow them are.
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil {
+				if pkgPath, ok := imports[x.Name]; ok && added[pkgPath][sel.Sel.Name] {
+					use(pkgPath + "." + sel.Sel.Name)
+				}
+			}
+			return true
+		})
+	})
+	sort.Strings(uses)
+	return uses, err
+}
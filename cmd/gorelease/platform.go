@@ -0,0 +1,174 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/tools/go/packages"
+)
+
+// A platform is a configuration in which packages are loaded. The API of a
+// module may differ between platforms; for example, golang.org/x/sys has
+// different packages on Unix and Windows.
+//
+// The zero platform is the configuration of the environment gorelease
+// runs in.
+type platform struct {
+	goos, goarch string
+
+	// cgo is the value of CGO_ENABLED, or "" to use the default for the
+	// platform.
+	cgo string
+}
+
+// parsePlatforms parses the value of the -platforms flag, a space-separated
+// list of platforms of the form GOOS/GOARCH, optionally followed by ",cgo" or
+// ",nocgo" to enable or disable cgo. If the list is empty, parsePlatforms
+// returns the zero platform alone.
+func parsePlatforms(list string) ([]platform, error) {
+	var plats []platform
+	seen := make(map[platform]bool)
+	for _, f := range strings.Fields(list) {
+		var p platform
+		osArch := f
+		if i := strings.Index(f, ","); i >= 0 {
+			osArch = f[:i]
+			switch f[i+1:] {
+			case "cgo":
+				p.cgo = "1"
+			case "nocgo":
+				p.cgo = "0"
+			default:
+				return nil, usageErrorf("-platforms: invalid platform %q: want GOOS/GOARCH, GOOS/GOARCH,cgo, or GOOS/GOARCH,nocgo", f)
+			}
+		}
+		if i := strings.Index(osArch, "/"); i > 0 && i < len(osArch)-1 && !strings.Contains(osArch[i+1:], "/") {
+			p.goos, p.goarch = osArch[:i], osArch[i+1:]
+		} else {
+			return nil, usageErrorf("-platforms: invalid platform %q: want GOOS/GOARCH, GOOS/GOARCH,cgo, or GOOS/GOARCH,nocgo", f)
+		}
+		if seen[p] {
+			return nil, usageErrorf("-platforms: platform %s is listed more than once", p)
+		}
+		seen[p] = true
+		plats = append(plats, p)
+	}
+	if len(plats) == 0 {
+		plats = []platform{{}}
+	}
+	return plats, nil
+}
+
+// String returns p in the form accepted by parsePlatforms.
+func (p platform) String() string {
+	s := p.goos + "/" + p.goarch
+	switch p.cgo {
+	case "1":
+		s += ",cgo"
+	case "0":
+		s += ",nocgo"
+	}
+	return s
+}
+
+// environ returns the environment for commands that load packages for p,
+// which is env with p's settings added. env is returned as is for the zero
+// platform.
+func (p platform) environ(env []string) []string {
+	if p == (platform{}) {
+		return env
+	}
+	env = append(env[:len(env):len(env)], "GOOS="+p.goos, "GOARCH="+p.goarch)
+	if p.cgo != "" {
+		env = append(env, "CGO_ENABLED="+p.cgo)
+	}
+	return env
+}
+
+// mergePackageReports merges lists of package reports made for each of the
+// platforms in plats into a single list, sorted like the lists by path
+// relative to the module path, baseModPath or releaseModPath.
+//
+// Changes and errors that occur on only some platforms are annotated with
+// those platforms, as by apidiff.MergePlatforms. A change that is
+// incompatible on any platform is incompatible: for example, removing a
+// function from the Windows version of a package breaks users on Windows,
+// even though the function is still available elsewhere.
+func mergePackageReports(plats []platform, reports [][]packageReport, baseModPath, releaseModPath string) []packageReport {
+	byPath := make(map[string][]*packageReport)
+	var paths []string
+	for i, prs := range reports {
+		for j := range prs {
+			pr := &prs[j]
+			if byPath[pr.path] == nil {
+				byPath[pr.path] = make([]*packageReport, len(plats))
+				paths = append(paths, pr.path)
+			}
+			byPath[pr.path][i] = pr
+		}
+	}
+	relPath := func(pkgPath string) string {
+		if hasPathPrefix(pkgPath, releaseModPath) {
+			return trimPathPrefix(pkgPath, releaseModPath)
+		}
+		return trimPathPrefix(pkgPath, baseModPath)
+	}
+	sort.SliceStable(paths, func(i, j int) bool {
+		return relPath(paths[i]) < relPath(paths[j])
+	})
+
+	var merged []packageReport
+	for _, path := range paths {
+		m := packageReport{path: path}
+		var platReports []apidiff.PlatformReport
+		var baseErrors, releaseErrors [][]packages.Error
+		for i, pr := range byPath[path] {
+			platReport := apidiff.PlatformReport{Platform: plats[i].String()}
+			if pr != nil {
+				platReport.Report = pr.Report
+				baseErrors = append(baseErrors, pr.baseErrors)
+				releaseErrors = append(releaseErrors, pr.releaseErrors)
+				if m.importedBy == nil {
+					m.importedBy = pr.importedBy
+				}
+			} else {
+				baseErrors = append(baseErrors, nil)
+				releaseErrors = append(releaseErrors, nil)
+			}
+			platReports = append(platReports, platReport)
+		}
+		m.Report = apidiff.MergePlatforms(platReports)
+		m.baseErrors = mergeErrors(plats, baseErrors)
+		m.releaseErrors = mergeErrors(plats, releaseErrors)
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// mergeErrors merges lists of errors reported for each of the platforms in
+// plats, in order. Errors that are reported for only some platforms are
+// annotated with those platforms.
+func mergeErrors(plats []platform, errs [][]packages.Error) []packages.Error {
+	var merged []packages.Error
+	platsByError := make(map[string][]string)
+	for i, platErrs := range errs {
+		for _, e := range platErrs {
+			key := e.Error()
+			if platsByError[key] == nil {
+				merged = append(merged, e)
+			}
+			platsByError[key] = append(platsByError[key], plats[i].String())
+		}
+	}
+	for i, e := range merged {
+		if ps := platsByError[e.Error()]; len(ps) < len(plats) {
+			merged[i].Msg += " (only on " + strings.Join(ps, ", ") + ")"
+		}
+	}
+	return merged
+}
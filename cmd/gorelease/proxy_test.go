@@ -136,15 +136,7 @@ func buildProxyDir() (proxyDir, proxyURL string, err error) {
 		buf.Reset()
 	}
 
-	// Make sure the URL path starts with a slash on Windows. Absolute paths
-	// normally start with a drive letter.
-	// TODO(golang.org/issue/32456): use url.FromFilePath when implemented.
-	if strings.HasPrefix(proxyDir, "/") {
-		proxyURL = "file://" + proxyDir
-	} else {
-		proxyURL = "file:///" + filepath.FromSlash(proxyDir)
-	}
-	return proxyDir, proxyURL, nil
+	return proxyDir, fileURL(proxyDir), nil
 }
 
 type txtarFile struct {
@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -33,6 +34,19 @@ type report struct {
 	// for individual packages, sorted by package path.
 	packages []packageReport
 
+	// requirements lists the requirements in go.mod that were added,
+	// removed, upgraded, or downgraded, sorted by module path. It is empty
+	// if there is no base version.
+	requirements []*requirementChange
+
+	// deprecations lists changes to deprecated APIs. It is set by
+	// trackDeprecations.
+	deprecations *deprecationReport
+
+	// zip describes the module zip file of the release version. It is set
+	// with -zip.
+	zip *zipReport
+
 	// versionInvalid explains why the proposed or suggested version is not valid.
 	versionInvalid *versionMessage
 
@@ -65,6 +79,26 @@ func (r *report) Text(w io.Writer) error {
 		}
 	}
 
+	if len(r.requirements) > 0 {
+		fmt.Fprintln(buf, "Requirement changes:")
+		for _, c := range r.requirements {
+			fmt.Fprintf(buf, "- %s\n", c)
+		}
+		buf.WriteByte('\n')
+	}
+
+	if r.deprecations != nil {
+		r.deprecations.Text(buf, semver.Major(r.release.version))
+	}
+
+	if r.zip != nil {
+		r.zip.Text(buf)
+	}
+
+	for _, w := range r.release.warnings {
+		fmt.Fprintln(buf, w)
+	}
+
 	baseVersion := r.base.version
 	if r.base.modPath != r.release.modPath {
 		baseVersion = r.base.modPath + "@" + baseVersion
@@ -108,6 +142,189 @@ unexpected for users. So, it may be better to choose a different suffix.`, r.rel
 	return err
 }
 
+// jsonReport is the form in which a report is written with -json. Its
+// fields are part of gorelease's output format; new fields may be added, but
+// existing fields should not be changed or removed.
+type jsonReport struct {
+	// Base and Release describe the compared versions of the module.
+	Base, Release jsonModule
+
+	// Packages lists the packages that have API changes or errors, sorted by
+	// package path.
+	Packages []jsonPackage `json:",omitempty"`
+
+	// Diagnostics lists problems with the release version that are not
+	// related to specific packages, such as an incomplete go.mod file.
+	Diagnostics []string `json:",omitempty"`
+
+	// Warnings lists problems that don't prevent a release, such as replace
+	// directives or requirements on pre-release versions in go.mod.
+	Warnings []string `json:",omitempty"`
+
+	// RequirementChanges lists the requirements in go.mod that were added,
+	// removed, or changed between the base and release versions, sorted by
+	// module path. It is empty if there is no base version.
+	RequirementChanges []jsonRequirementChange `json:",omitempty"`
+
+	// Deprecations lists changes to deprecated APIs, if there are any.
+	Deprecations *jsonDeprecations `json:",omitempty"`
+
+	// Zip describes the module zip file of the release version. It is only
+	// set with -zip.
+	Zip *jsonZip `json:",omitempty"`
+
+	// VersionInvalid explains why the release version is not valid, or why
+	// no version could be suggested.
+	VersionInvalid *jsonVersionMessage `json:",omitempty"`
+
+	// Success is true if the module appears to be safe to release at
+	// Release.Version. gorelease exits with a non-zero status otherwise.
+	Success bool
+}
+
+// jsonModule describes one version of a module in a jsonReport.
+type jsonModule struct {
+	Path string
+	// Version is the resolved version, or "none" for a base version if
+	// there is none. For the release, it is the version given with -version
+	// or the suggested version, and may be empty if neither is known.
+	Version string `json:",omitempty"`
+	// VersionQuery is the version query given with -base, if any, such as
+	// "latest".
+	VersionQuery string `json:",omitempty"`
+	// VersionInferred is true if the base version was inferred or the release
+	// version was suggested.
+	VersionInferred bool `json:",omitempty"`
+	// TagPrefix is the prefix for version tags if the module is not in the
+	// repository root directory, as in "sub/".
+	TagPrefix string `json:",omitempty"`
+	// GoVersion is the version in the go directive of go.mod.
+	GoVersion string `json:",omitempty"`
+}
+
+// jsonPackage describes the changes and errors in one package.
+type jsonPackage struct {
+	Path string
+
+	// ImportedBy lists the nested modules that import the package, if it is
+	// an internal package compared because of such imports.
+	ImportedBy []string `json:",omitempty"`
+
+	// Incompatible and Compatible list the API changes, as encoded by
+	// apidiff.Report.JSON. Each change has a Message, as in the text report,
+	// and the structured fields of an apidiff.Change: the Package and Object
+	// changed, the Part of the object if the change is to a part of it, a
+	// stable Kind code such as "removed" or "type-changed", and for some
+	// kinds, Old and New descriptions like types or values. Platforms lists
+	// the platforms on which a change occurs, if not all of those compared.
+	// A change to a package as a whole, like "package removed", has an
+	// empty Object. Changes to re-exported APIs of dependencies have the package
+	// path of the dependency.
+	Incompatible []apidiff.Change `json:",omitempty"`
+	Compatible   []apidiff.Change `json:",omitempty"`
+
+	BaseErrors    []string `json:",omitempty"`
+	ReleaseErrors []string `json:",omitempty"`
+}
+
+// jsonRequirementChange describes a change to a requirement in go.mod.
+// Base is empty if the requirement was added, and Release is empty if it
+// was removed.
+type jsonRequirementChange struct {
+	Path    string
+	Base    string `json:",omitempty"`
+	Release string `json:",omitempty"`
+	// ReleasePath is the module path of the release version's requirement
+	// when it replaced a requirement on another major version of the module,
+	// Path.
+	ReleasePath string `json:",omitempty"`
+
+	// Kind is "added", "removed", "upgraded", or "downgraded".
+	Kind string
+	// Level is the most significant part of the version that changed when
+	// the requirement was upgraded or downgraded: "major", "minor", "patch",
+	// or "pre-release".
+	Level string `json:",omitempty"`
+	// ReexportedBy lists the packages whose APIs include types from the
+	// required module that changed.
+	ReexportedBy []string `json:",omitempty"`
+}
+
+type jsonVersionMessage struct {
+	Message, Reason string
+}
+
+// JSON writes a report to w as indented JSON, in the form of a jsonReport.
+func (r *report) JSON(w io.Writer) error {
+	jr := jsonReport{
+		Base:        r.base.jsonModule(),
+		Release:     r.release.jsonModule(),
+		Diagnostics: r.release.diagnostics,
+		Warnings:    r.release.warnings,
+		Success:     r.isSuccessful(),
+	}
+	for _, c := range r.requirements {
+		jr.RequirementChanges = append(jr.RequirementChanges, jsonRequirementChange{
+			Path:         c.path,
+			Base:         c.base,
+			Release:      c.release,
+			ReleasePath:  c.releasePath,
+			Kind:         c.kind(),
+			Level:        c.level(),
+			ReexportedBy: c.reexportedBy,
+		})
+	}
+	for _, p := range r.packages {
+		if len(p.Changes) == 0 && len(p.baseErrors) == 0 && len(p.releaseErrors) == 0 {
+			continue
+		}
+		jp := jsonPackage{Path: p.path, ImportedBy: p.importedBy}
+		for _, c := range p.Changes {
+			if c.Compatible {
+				jp.Compatible = append(jp.Compatible, c)
+			} else {
+				jp.Incompatible = append(jp.Incompatible, c)
+			}
+		}
+		for _, e := range p.baseErrors {
+			jp.BaseErrors = append(jp.BaseErrors, e.Error())
+		}
+		for _, e := range p.releaseErrors {
+			jp.ReleaseErrors = append(jp.ReleaseErrors, e.Error())
+		}
+		jr.Packages = append(jr.Packages, jp)
+	}
+	if r.deprecations != nil && !r.deprecations.isEmpty() {
+		jr.Deprecations = r.deprecations.jsonDeprecations()
+	}
+	if r.zip != nil {
+		jr.Zip = r.zip.jsonZip()
+	}
+	if r.versionInvalid != nil {
+		jr.VersionInvalid = &jsonVersionMessage{
+			Message: r.versionInvalid.message,
+			Reason:  r.versionInvalid.reason,
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(jr)
+}
+
+func (m *moduleInfo) jsonModule() jsonModule {
+	jm := jsonModule{
+		Path:            m.modPath,
+		Version:         m.version,
+		VersionQuery:    m.versionQuery,
+		VersionInferred: m.versionInferred,
+		TagPrefix:       m.tagPrefix,
+	}
+	if m.goModFile != nil && m.goModFile.Go != nil {
+		jm.GoVersion = m.goModFile.Go.Version
+	}
+	return jm
+}
+
 func (r *report) addPackage(p packageReport) {
 	r.packages = append(r.packages, p)
 	if len(p.baseErrors) == 0 && len(p.releaseErrors) == 0 {
@@ -349,6 +566,10 @@ type packageReport struct {
 	apidiff.Report
 	path                      string
 	baseErrors, releaseErrors []packages.Error
+
+	// importedBy lists the nested modules that import this package, if it is
+	// an internal package compared because of such imports.
+	importedBy []string
 }
 
 func (p *packageReport) Text(w io.Writer) error {
@@ -357,6 +578,9 @@ func (p *packageReport) Text(w io.Writer) error {
 	}
 	buf := &bytes.Buffer{}
 	fmt.Fprintf(buf, "%s\n%s\n", p.path, strings.Repeat("-", len(p.path)))
+	if len(p.importedBy) > 0 {
+		fmt.Fprintf(buf, "internal package imported by %s\n\n", strings.Join(p.importedBy, ", "))
+	}
 	if len(p.baseErrors) > 0 {
 		fmt.Fprintf(buf, "errors in base version:\n")
 		for _, e := range p.baseErrors {
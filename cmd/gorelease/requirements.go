@@ -0,0 +1,361 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/apidiff"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"golang.org/x/tools/go/packages"
+)
+
+// A requirementChange describes a requirement in go.mod that was added,
+// removed, upgraded, or downgraded between the base and release versions.
+type requirementChange struct {
+	path string
+
+	// releasePath is the path of the required module in the release version
+	// if it differs from path, as when a requirement on path is replaced by
+	// one on a new major version of the module, path/vN. It is "" otherwise.
+	releasePath string
+
+	// base and release are the required versions. base is "" if the
+	// requirement was added, and release is "" if it was removed.
+	base, release string
+
+	// reexportedBy lists the packages of the release version whose APIs
+	// include types from the required module that changed, sorted by path.
+	// See reexportedChanges.
+	reexportedBy []string
+}
+
+// kind returns "added", "removed", "upgraded", or "downgraded".
+func (c *requirementChange) kind() string {
+	switch {
+	case c.base == "":
+		return "added"
+	case c.release == "":
+		return "removed"
+	case semver.Compare(c.base, c.release) < 0:
+		return "upgraded"
+	default:
+		return "downgraded"
+	}
+}
+
+// level returns the most significant part of the version that changed when
+// a requirement is upgraded or downgraded: "major", "minor", "patch", or
+// "pre-release". It returns "" if the requirement was added or removed.
+// A requirement replaced by one on another major version of the module is a
+// major upgrade or downgrade.
+func (c *requirementChange) level() string {
+	if c.base == "" || c.release == "" {
+		return ""
+	}
+	release := func(v string) string {
+		v = semver.Canonical(v)
+		return strings.TrimSuffix(v, semver.Prerelease(v))
+	}
+	switch {
+	case semver.Major(c.base) != semver.Major(c.release):
+		return "major"
+	case semver.MajorMinor(c.base) != semver.MajorMinor(c.release):
+		return "minor"
+	case release(c.base) != release(c.release):
+		return "patch"
+	default:
+		return "pre-release"
+	}
+}
+
+func (c *requirementChange) String() string {
+	s := c.summary()
+	if len(c.reexportedBy) > 0 {
+		s += "\n\tAPI changes are re-exported by " + strings.Join(c.reexportedBy, ", ")
+	}
+	return s
+}
+
+// summary describes the change in a single line, without the packages that
+// re-export changes.
+func (c *requirementChange) summary() string {
+	switch kind := c.kind(); kind {
+	case "added":
+		return fmt.Sprintf("%s: added at %s", c.path, c.release)
+	case "removed":
+		return fmt.Sprintf("%s: removed (was %s)", c.path, c.base)
+	default:
+		release := c.release
+		if c.releasePath != "" {
+			release = c.releasePath + " " + c.release
+		}
+		return fmt.Sprintf("%s: %s from %s to %s (%s)", c.path, kind, c.base, release, c.level())
+	}
+}
+
+// requirementChanges returns the requirements that were added, removed, or
+// changed between the base and release go.mod files, sorted by module path.
+// It returns nil if there is no base version.
+//
+// A requirement on a module path that was removed, like example.com/m, and
+// one on another major version of the same module that was added, like
+// example.com/m/v2, are reported together as a single upgrade or downgrade,
+// if there is no other candidate for the pairing.
+func requirementChanges(base, release *modfile.File) []*requirementChange {
+	if base == nil || release == nil {
+		return nil
+	}
+	baseReqs := make(map[string]string)
+	for _, req := range base.Require {
+		baseReqs[req.Mod.Path] = req.Mod.Version
+	}
+	var changes []*requirementChange
+	for _, req := range release.Require {
+		baseVersion, ok := baseReqs[req.Mod.Path]
+		delete(baseReqs, req.Mod.Path)
+		if !ok || baseVersion != req.Mod.Version {
+			changes = append(changes, &requirementChange{path: req.Mod.Path, base: baseVersion, release: req.Mod.Version})
+		}
+	}
+	for path, version := range baseReqs {
+		changes = append(changes, &requirementChange{path: path, base: version})
+	}
+	changes = pairMajorVersions(changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].path < changes[j].path })
+	return changes
+}
+
+// pairMajorVersions merges each removed requirement in changes with the
+// added requirement on another major version of the same module, if each
+// is the only one with that path prefix.
+func pairMajorVersions(changes []*requirementChange) []*requirementChange {
+	pathPrefix := func(path string) string {
+		prefix, _, _ := module.SplitPathVersion(path)
+		return prefix
+	}
+	removed := make(map[string][]*requirementChange)
+	added := make(map[string][]*requirementChange)
+	for _, c := range changes {
+		switch c.kind() {
+		case "removed":
+			removed[pathPrefix(c.path)] = append(removed[pathPrefix(c.path)], c)
+		case "added":
+			added[pathPrefix(c.path)] = append(added[pathPrefix(c.path)], c)
+		}
+	}
+	paired := make(map[*requirementChange]bool)
+	for prefix, rs := range removed {
+		as := added[prefix]
+		if len(rs) != 1 || len(as) != 1 {
+			continue
+		}
+		r, a := rs[0], as[0]
+		r.releasePath, r.release = a.path, a.release
+		paired[a] = true
+	}
+	n := 0
+	for _, c := range changes {
+		if !paired[c] {
+			changes[n] = c
+			n++
+		}
+	}
+	return changes[:n]
+}
+
+// reexportedChanges returns the changes to the APIs of dependencies that are
+// visible through the API of releasePkg, for dependencies provided by modules
+// whose requirements were upgraded or downgraded.
+//
+// A type from another package that appears in an exported declaration, like
+// the type of a function parameter, is part of the package's API. If a field
+// is removed from that type, users of the package may break, even though the
+// package itself didn't change. apidiff compares such types by name only, so
+// reexportedChanges compares the dependency packages imported by basePkg and
+// releasePkg and keeps the changes to the types that releasePkg refers to.
+//
+// The message of each change is qualified by the path of the dependency
+// package. The path of releasePkg is added to the reexportedBy field of the
+// requirement changes that have any.
+func reexportedChanges(basePkg, releasePkg *packages.Package, reqs []*requirementChange) []apidiff.Change {
+	if basePkg.Types == nil || releasePkg.Types == nil {
+		return nil
+	}
+	refs := referencedTypes(releasePkg.Types)
+	depPaths := make([]string, 0, len(refs))
+	for depPath := range refs {
+		depPaths = append(depPaths, depPath)
+	}
+	sort.Strings(depPaths)
+
+	var changes []apidiff.Change
+	for _, depPath := range depPaths {
+		req := findRequirement(reqs, depPath)
+		if req == nil {
+			continue
+		}
+		baseDep, releaseDep := findDependency(basePkg, depPath), findDependency(releasePkg, depPath)
+		if baseDep == nil || releaseDep == nil || baseDep.Types == nil || releaseDep.Types == nil {
+			continue
+		}
+		n := len(changes)
+		for _, c := range apidiff.Changes(baseDep.Types, releaseDep.Types).Changes {
+			if refs[depPath][topLevelName(c.Object)] {
+				c.Message = depPath + "." + c.Message
+				changes = append(changes, c)
+			}
+		}
+		if len(changes) > n && !containsString(req.reexportedBy, releasePkg.PkgPath) {
+			// Packages may be compared for several platforms.
+			req.reexportedBy = append(req.reexportedBy, releasePkg.PkgPath)
+			sort.Strings(req.reexportedBy)
+		}
+	}
+	return changes
+}
+
+func containsString(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// findRequirement returns the upgraded or downgraded requirement in reqs
+// that provides the package pkgPath, or nil if there is none. If several
+// module paths are prefixes of pkgPath, the longest is used, as the go
+// command would if the package were provided by only one of them.
+func findRequirement(reqs []*requirementChange, pkgPath string) *requirementChange {
+	var found *requirementChange
+	for _, req := range reqs {
+		if req.base == "" || req.release == "" || req.releasePath != "" || !hasPathPrefix(pkgPath, req.path) {
+			continue
+		}
+		if found == nil || len(req.path) > len(found.path) {
+			found = req
+		}
+	}
+	return found
+}
+
+// findDependency returns the package with the given path among the
+// dependencies of pkg, or nil if pkg doesn't depend on it.
+func findDependency(pkg *packages.Package, path string) *packages.Package {
+	seen := make(map[*packages.Package]bool)
+	queue := []*packages.Package{pkg}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if p.PkgPath == path {
+			return p
+		}
+		for _, imp := range p.Imports {
+			if !seen[imp] {
+				seen[imp] = true
+				queue = append(queue, imp)
+			}
+		}
+	}
+	return nil
+}
+
+// referencedTypes returns the exported named types from other packages
+// that appear in the exported API of pkg, as a map from package path to the
+// set of type names.
+func referencedTypes(pkg *types.Package) map[string]map[string]bool {
+	refs := make(map[string]map[string]bool)
+	seen := make(map[types.Type]bool)
+	var walk func(types.Type)
+	walk = func(t types.Type) {
+		t = types.Unalias(t)
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		switch t := t.(type) {
+		case *types.Named:
+			obj := t.Obj()
+			if obj.Pkg() == nil {
+				// A predeclared type like error.
+				return
+			}
+			if obj.Pkg() != pkg {
+				if obj.Exported() {
+					if refs[obj.Pkg().Path()] == nil {
+						refs[obj.Pkg().Path()] = make(map[string]bool)
+					}
+					refs[obj.Pkg().Path()][obj.Name()] = true
+				}
+				return
+			}
+			walk(t.Underlying())
+			for i := 0; i < t.NumMethods(); i++ {
+				if m := t.Method(i); m.Exported() {
+					walk(m.Type())
+				}
+			}
+		case *types.Pointer:
+			walk(t.Elem())
+		case *types.Slice:
+			walk(t.Elem())
+		case *types.Array:
+			walk(t.Elem())
+		case *types.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case *types.Chan:
+			walk(t.Elem())
+		case *types.Signature:
+			for i := 0; i < t.Params().Len(); i++ {
+				walk(t.Params().At(i).Type())
+			}
+			for i := 0; i < t.Results().Len(); i++ {
+				walk(t.Results().At(i).Type())
+			}
+		case *types.Struct:
+			for i := 0; i < t.NumFields(); i++ {
+				// Embedded fields of unexported types may promote exported
+				// fields and methods.
+				if f := t.Field(i); f.Exported() || f.Embedded() {
+					walk(f.Type())
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < t.NumExplicitMethods(); i++ {
+				if m := t.ExplicitMethod(i); m.Exported() {
+					walk(m.Type())
+				}
+			}
+			for i := 0; i < t.NumEmbeddeds(); i++ {
+				walk(t.EmbeddedType(i))
+			}
+		}
+	}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if obj := scope.Lookup(name); obj.Exported() {
+			walk(obj.Type())
+		}
+	}
+	return refs
+}
+
+// topLevelName returns the name of the package-level object that contains
+// the object named by an apidiff.Change, such as "T" for "T" and "(*T).M".
+func topLevelName(object string) string {
+	object = strings.TrimPrefix(object, "(*")
+	if i := strings.IndexAny(object, ".)"); i >= 0 {
+		object = object[:i]
+	}
+	return object
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Internal packages of a module may be imported by other modules nested
+// within it. For example, golang.org/x/tools/gopls imports
+// golang.org/x/tools/internal/lsp. An incompatible change to such a package
+// breaks the nested module when it is built with the new version of the
+// outer module, so gorelease compares those packages as if they were not
+// internal.
+
+// findSubmoduleImports returns the internal packages of the module modPath
+// that are imported by modules nested within modRoot. Each package path is
+// mapped to the sorted paths of the modules that import it.
+//
+// submodules is the value of the -submodules flag: "auto" to find all
+// nested modules, "none" to ignore them, or a comma-separated list of
+// module directories, relative to modRoot.
+func findSubmoduleImports(modRoot, modPath, submodules string) (map[string][]string, error) {
+	var dirs []string
+	switch submodules {
+	case "none":
+		return nil, nil
+	case "auto", "":
+		var err error
+		if dirs, err = findSubmoduleDirs(modRoot); err != nil {
+			return nil, err
+		}
+	default:
+		for _, rel := range strings.Split(submodules, ",") {
+			rel = strings.TrimSpace(rel)
+			dir := filepath.Join(modRoot, filepath.FromSlash(rel))
+			if dir == modRoot || !hasFilePathPrefix(dir, modRoot) {
+				return nil, usageErrorf("-submodules: %s is not a subdirectory of the module root directory", rel)
+			}
+			if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil || fi.IsDir() {
+				return nil, usageErrorf("-submodules: %s does not contain a go.mod file", rel)
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	importers := make(map[string]map[string]bool)
+	for _, dir := range dirs {
+		goModPath := filepath.Join(dir, "go.mod")
+		data, err := ioutil.ReadFile(goModPath)
+		if err != nil {
+			return nil, err
+		}
+		subModPath := modfile.ModulePath(data)
+		if subModPath == "" {
+			return nil, fmt.Errorf("%s: module directive is missing", goModPath)
+		}
+		imports, err := moduleImports(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, imp := range imports {
+			if hasPathPrefix(imp, modPath) && !hasPathPrefix(imp, subModPath) && isInternal(modPath, imp) {
+				if importers[imp] == nil {
+					importers[imp] = make(map[string]bool)
+				}
+				importers[imp][subModPath] = true
+			}
+		}
+	}
+
+	m := make(map[string][]string)
+	for imp, subModPaths := range importers {
+		for subModPath := range subModPaths {
+			m[imp] = append(m[imp], subModPath)
+		}
+		sort.Strings(m[imp])
+	}
+	return m, nil
+}
+
+// findSubmoduleDirs returns the directories within modRoot, other than
+// modRoot itself, that contain go.mod files. Like the go command, it skips
+// vendor and testdata directories and directories whose names begin with
+// "." or "_".
+func findSubmoduleDirs(modRoot string) ([]string, error) {
+	var dirs []string
+	err := filepath.Walk(modRoot, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() || p == modRoot {
+			return nil
+		}
+		if name := fi.Name(); name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return filepath.SkipDir
+		}
+		if fi, err := os.Stat(filepath.Join(p, "go.mod")); err == nil && !fi.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	return dirs, err
+}
+
+// moduleImports returns the import paths in the Go files of the module
+// whose root directory is modRoot, including test files. Directories of
+// nested modules are not included.
+func moduleImports(modRoot string) ([]string, error) {
+	seen := make(map[string]bool)
+	var imports []string
+	err := parseModuleFiles(modRoot, parser.ImportsOnly, func(_ string, f *ast.File) {
+		for _, spec := range f.Imports {
+			imp, err := strconv.Unquote(spec.Path.Value)
+			if err == nil && !seen[imp] {
+				seen[imp] = true
+				imports = append(imports, imp)
+			}
+		}
+	})
+	return imports, err
+}
+
+// parseModuleFiles parses the Go files of the module whose root directory is
+// modRoot, including test files, with the given mode, and calls fn with the
+// path and syntax tree of each file. Directories of nested modules are not
+// included. Files that can't be parsed are skipped; their errors are reported
+// when the module is built.
+func parseModuleFiles(modRoot string, mode parser.Mode, fn func(string, *ast.File)) error {
+	fset := token.NewFileSet()
+	return filepath.Walk(modRoot, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if p == modRoot {
+				return nil
+			}
+			if name := fi.Name(); name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(p, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(p, ".go") {
+			return nil
+		}
+		if f, err := parser.ParseFile(fset, p, nil, mode); err == nil {
+			fn(p, f)
+		}
+		return nil
+	})
+}
+
+// isInternal reports whether pkgPath, a package in the module modPath, is
+// internal to the module: that is, whether it has a path element named
+// "internal" after the module path.
+func isInternal(modPath, pkgPath string) bool {
+	if !hasPathPrefix(pkgPath, modPath) {
+		panic(fmt.Sprintf("package %s not in module %s", pkgPath, modPath))
+	}
+	for pkgPath != modPath {
+		if path.Base(pkgPath) == "internal" {
+			return true
+		}
+		pkgPath = path.Dir(pkgPath)
+	}
+	return false
+}
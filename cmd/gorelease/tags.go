@@ -0,0 +1,247 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/zip"
+)
+
+// checkTags checks the version tags of the module in its git repository.
+//
+// The tag for the release version must not exist yet. If it does, the release
+// version is not valid.
+//
+// The tag for the base version, if it exists, must point to the same content
+// as the base version in the module cache. If someone moved the tag after the
+// version was published, users who download the version from a proxy or from
+// the module cache get different code than users who see the repository, and
+// the release is comparing against the wrong content. Such a mismatch is
+// reported as a diagnostic.
+func (r *report) checkTags() error {
+	repoRoot, err := r.gitRepoRoot()
+	if err != nil {
+		return err
+	}
+
+	if r.release.version != "" && r.versionInvalid == nil {
+		tag := r.release.tagPrefix + r.release.version
+		exists, err := gitTagExists(repoRoot, tag)
+		if err != nil {
+			return err
+		}
+		if exists {
+			message := fmt.Sprintf("%s is not a valid semantic version for this release.", r.release.version)
+			if r.release.versionInferred {
+				message = "Cannot suggest a release version."
+			}
+			r.versionInvalid = &versionMessage{
+				message: message,
+				reason:  fmt.Sprintf("Tag %s already exists.", tag),
+			}
+		}
+	}
+
+	// Only downloaded base versions of the same module have tags and hashes
+	// to compare. Pseudo-versions don't have tags.
+	if r.base.version == "none" || r.base.zipSum == "" || r.base.modPath != r.release.modPath || isPseudoVersion(r.base.version) {
+		return nil
+	}
+	tag := r.release.tagPrefix + strings.TrimSuffix(r.base.version, "+incompatible")
+	exists, err := gitTagExists(repoRoot, tag)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		r.release.warnings = append(r.release.warnings, fmt.Sprintf("Tag %s for the base version was not found in the repository, so its content was not checked.", tag))
+		return nil
+	}
+	modDir, err := filepath.Rel(repoRoot, r.release.modRoot)
+	if err != nil {
+		return err
+	}
+	sum, err := gitModuleSum(repoRoot, tag, filepath.ToSlash(modDir), module.Version{Path: r.base.modPath, Version: r.base.version})
+	if err != nil {
+		return err
+	}
+	if sum != r.base.zipSum {
+		r.release.diagnostics = append(r.release.diagnostics, fmt.Sprintf(`Tag %s does not match %s@%s in the module cache.
+	The tag has content with hash %s,
+	but the module cache has %s.
+	The tag may have been moved after the version was published.`, tag, r.base.modPath, r.base.version, sum, r.base.zipSum))
+	}
+	return nil
+}
+
+// createTag creates an annotated tag for the release version at the
+// repository's HEAD commit, after checking tags with checkTags. The tag's
+// message is the module path and version followed by the report. The tag is
+// only created if the report is successful and the module's directory has no
+// uncommitted changes, since those would not be part of the tagged version.
+//
+// createTag writes a line to w saying whether the tag was created.
+func (r *report) createTag(w io.Writer) error {
+	repoRoot, err := r.gitRepoRoot()
+	if err != nil {
+		return err
+	}
+	if !r.isSuccessful() || r.release.version == "" {
+		_, err := fmt.Fprintf(w, "\nNo tag was created, since the release version is not valid.\n")
+		return err
+	}
+	tag := r.release.tagPrefix + r.release.version
+	status, err := runGit(repoRoot, "status", "--porcelain", "--", r.release.modRoot)
+	if err != nil {
+		return err
+	}
+	if status != "" {
+		return fmt.Errorf("can't create tag %s: %s has uncommitted changes", tag, r.release.modRoot)
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "%s %s\n\n", r.release.modPath, r.release.version)
+	if err := r.Text(msg); err != nil {
+		return err
+	}
+	if _, err := runGit(repoRoot, "tag", "-a", "-m", msg.String(), tag); err != nil {
+		return fmt.Errorf("can't create tag %s: %v", tag, err)
+	}
+	_, err = fmt.Fprintf(w, "\nCreated tag %s.\n", tag)
+	return err
+}
+
+// gitRepoRoot returns the root directory of the release version's
+// repository, which must be a git repository.
+func (r *report) gitRepoRoot() (string, error) {
+	repoRoot := r.release.repoRoot
+	if repoRoot == "" {
+		return "", fmt.Errorf("-tag: module is not in a repository")
+	}
+	if _, err := os.Stat(filepath.Join(repoRoot, ".git")); err != nil {
+		return "", fmt.Errorf("-tag: %s is not a git repository", repoRoot)
+	}
+	return repoRoot, nil
+}
+
+// gitTagExists reports whether the repository in repoRoot has the given tag.
+func gitTagExists(repoRoot, tag string) (bool, error) {
+	out, err := runGit(repoRoot, "tag", "--list", "--", tag)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) == tag, nil
+}
+
+// gitModuleSum returns the hash of the zip file of module version m, as
+// recorded in go.sum, created from the files at revision rev in the directory
+// modDir of the git repository in repoRoot. modDir is slash-separated and
+// relative to repoRoot, or "." for the repository root.
+//
+// Like the go command, gitModuleSum includes the LICENSE file at the root of
+// the repository if the module is in a subdirectory without its own.
+func gitModuleSum(repoRoot, rev, modDir string, m module.Version) (string, error) {
+	if modDir == "." {
+		modDir = ""
+	}
+	files, err := gitFiles(repoRoot, rev, modDir)
+	if err != nil {
+		return "", err
+	}
+	if modDir != "" {
+		haveLICENSE := false
+		for _, f := range files {
+			if f.Path() == "LICENSE" {
+				haveLICENSE = true
+				break
+			}
+		}
+		if !haveLICENSE {
+			rootFiles, err := gitFiles(repoRoot, rev, "")
+			if err != nil {
+				return "", err
+			}
+			for _, f := range rootFiles {
+				if f.Path() == "LICENSE" {
+					files = append(files, f)
+					break
+				}
+			}
+		}
+	}
+
+	cf, err := zip.CheckFiles(files)
+	if err != nil {
+		return "", fmt.Errorf("files at %s:%s are not a valid module: %v", rev, modDir, err)
+	}
+	byPath := make(map[string]zip.File)
+	for _, f := range files {
+		byPath[f.Path()] = f
+	}
+	prefix := m.Path + "@" + m.Version + "/"
+	names := make([]string, len(cf.Valid))
+	for i, p := range cf.Valid {
+		names[i] = prefix + p
+	}
+	return dirhash.Hash1(names, func(name string) (io.ReadCloser, error) {
+		return byPath[strings.TrimPrefix(name, prefix)].Open()
+	})
+}
+
+// gitFiles returns the files at revision rev in the directory dir of the git
+// repository in repoRoot, with paths relative to dir. dir is slash-separated,
+// or "" for the repository root.
+//
+// Like the go command, gitFiles disables line ending conversion, so that the
+// files are the same as in the module zip whatever the repository's
+// configuration.
+func gitFiles(repoRoot, rev, dir string) ([]zip.File, error) {
+	out, err := runGit(repoRoot, "-c", "core.autocrlf=input", "-c", "core.eol=lf", "archive", "--format=tar", rev+":"+dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s at %s: %v", dir, rev, err)
+	}
+	var files []zip.File
+	tr := tar.NewReader(strings.NewReader(out))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeDir || hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, archiveFile{path: hdr.Name, info: hdr.FileInfo(), data: data})
+	}
+	return files, nil
+}
+
+// archiveFile is a file read from an archive, implementing zip.File.
+type archiveFile struct {
+	path string
+	info os.FileInfo
+	data []byte
+}
+
+func (f archiveFile) Path() string                { return f.path }
+func (f archiveFile) Lstat() (os.FileInfo, error) { return f.info, nil }
+func (f archiveFile) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
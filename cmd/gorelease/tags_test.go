@@ -0,0 +1,176 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+	"golang.org/x/mod/zip"
+)
+
+// initTagRepo creates a git repository with the module example.com/m in its
+// root directory, tagged v1.0.0, and returns the directory.
+func initTagRepo(t *testing.T) string {
+	t.Helper()
+	repo := initGitRepo(t)
+	gitCommit(t, repo, "v1.0.0", map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.12\n",
+		"m.go":   "package m\n\nfunc M() {}\n",
+	})
+	gitT(t, repo, "tag", "v1.0.0")
+	return repo
+}
+
+// newTagReport returns a report for the release version of the module in
+// repo, compared with base version v1.0.0, whose zip file has the hash
+// zipSum.
+func newTagReport(repo, version, zipSum string) *report {
+	return &report{
+		base: moduleInfo{
+			modPath: "example.com/m",
+			version: "v1.0.0",
+			zipSum:  zipSum,
+		},
+		release: moduleInfo{
+			modPath:  "example.com/m",
+			version:  version,
+			repoRoot: repo,
+			modRoot:  repo,
+		},
+	}
+}
+
+// dirZipSum returns the hash of the zip file of module version m created
+// from the files in dir, as the go command would record it in go.sum.
+func dirZipSum(t *testing.T, dir string, m module.Version) string {
+	t.Helper()
+	zipFile := filepath.Join(t.TempDir(), "m.zip")
+	f, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zip.CreateFromDir(f, m, dir); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := dirhash.HashZip(zipFile, dirhash.Hash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sum
+}
+
+func TestCheckTagsReleaseTagExists(t *testing.T) {
+	repo := initTagRepo(t)
+	gitT(t, repo, "tag", "v1.1.0")
+	r := newTagReport(repo, "v1.1.0", "")
+	if err := r.checkTags(); err != nil {
+		t.Fatal(err)
+	}
+	if r.versionInvalid == nil {
+		t.Fatal("release version is valid; want invalid since its tag exists")
+	}
+	if want := "Tag v1.1.0 already exists."; r.versionInvalid.reason != want {
+		t.Errorf("got reason %q; want %q", r.versionInvalid.reason, want)
+	}
+}
+
+func TestCheckTagsBaseTag(t *testing.T) {
+	repo := initTagRepo(t)
+	// Line ending conversion must not change the content read from the tag.
+	gitT(t, repo, "config", "core.autocrlf", "true")
+	sum := dirZipSum(t, repo, module.Version{Path: "example.com/m", Version: "v1.0.0"})
+
+	t.Run("match", func(t *testing.T) {
+		r := newTagReport(repo, "v1.1.0", sum)
+		if err := r.checkTags(); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.release.diagnostics) > 0 || len(r.release.warnings) > 0 || r.versionInvalid != nil {
+			t.Errorf("got diagnostics %q, warnings %q and invalid version %v; want none", r.release.diagnostics, r.release.warnings, r.versionInvalid)
+		}
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		r := newTagReport(repo, "v1.1.0", "h1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+		if err := r.checkTags(); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.release.diagnostics) != 1 || !strings.HasPrefix(r.release.diagnostics[0], "Tag v1.0.0 does not match example.com/m@v1.0.0 in the module cache.") {
+			t.Fatalf("got diagnostics %q; want a mismatch of tag v1.0.0", r.release.diagnostics)
+		}
+		if !strings.Contains(r.release.diagnostics[0], "The tag has content with hash "+sum) {
+			t.Errorf("diagnostic %q does not mention the hash of the tag's content, %s", r.release.diagnostics[0], sum)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		gitT(t, repo, "tag", "-d", "v1.0.0")
+		defer gitT(t, repo, "tag", "v1.0.0", "HEAD")
+		r := newTagReport(repo, "v1.1.0", sum)
+		if err := r.checkTags(); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.release.warnings) != 1 || !strings.HasPrefix(r.release.warnings[0], "Tag v1.0.0 for the base version was not found") {
+			t.Errorf("got warnings %q; want a missing tag v1.0.0", r.release.warnings)
+		}
+	})
+}
+
+func TestCreateTag(t *testing.T) {
+	t.Run("created", func(t *testing.T) {
+		repo := initTagRepo(t)
+		r := newTagReport(repo, "v1.1.0", "")
+		buf := &bytes.Buffer{}
+		if err := r.createTag(buf); err != nil {
+			t.Fatal(err)
+		}
+		if want := "\nCreated tag v1.1.0.\n"; buf.String() != want {
+			t.Errorf("got output %q; want %q", buf.String(), want)
+		}
+		msg := gitT(t, repo, "tag", "--list", "--format=%(contents)", "v1.1.0")
+		if want := "example.com/m v1.1.0\n\n"; !strings.HasPrefix(msg, want) {
+			t.Errorf("got tag message %q; want prefix %q", msg, want)
+		}
+	})
+
+	t.Run("invalid_version", func(t *testing.T) {
+		repo := initTagRepo(t)
+		r := newTagReport(repo, "v1.1.0", "")
+		r.versionInvalid = &versionMessage{message: "v1.1.0 is not a valid semantic version for this release."}
+		buf := &bytes.Buffer{}
+		if err := r.createTag(buf); err != nil {
+			t.Fatal(err)
+		}
+		if want := "\nNo tag was created, since the release version is not valid.\n"; buf.String() != want {
+			t.Errorf("got output %q; want %q", buf.String(), want)
+		}
+		if exists, err := gitTagExists(repo, "v1.1.0"); err != nil || exists {
+			t.Errorf("tag v1.1.0 exists: %v, %v; want it not to exist", exists, err)
+		}
+	})
+
+	t.Run("uncommitted_changes", func(t *testing.T) {
+		repo := initTagRepo(t)
+		if err := ioutil.WriteFile(filepath.Join(repo, "m.go"), []byte("package m\n"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		r := newTagReport(repo, "v1.1.0", "")
+		err := r.createTag(ioutil.Discard)
+		if err == nil || !strings.Contains(err.Error(), "has uncommitted changes") {
+			t.Errorf("got error %v; want an error about uncommitted changes", err)
+		}
+	})
+}
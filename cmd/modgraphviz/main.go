@@ -10,14 +10,33 @@
 //	go mod graph | modgraphviz > graph.dot
 //	go mod graph | modgraphviz | dot -Tpng -o graph.png
 //
-// Modgraphviz takes no options or arguments; it reads a graph in the format
-// generated by “go mod graph” on standard input and writes DOT language
-// on standard output.
+// Modgraphviz reads a graph in the format generated by “go mod graph” on
+// standard input and writes DOT language on standard output.
 //
 // For each module, the node representing the greatest version (i.e., the
 // version chosen by Go's minimal version selection algorithm) is colored green.
 // Other nodes, which aren't in the final build list, are colored grey.
 //
+// Graphs of large modules may be too big to lay out or read. These flags
+// select part of the graph:
+//
+//	-focus module
+//		Show only modules on requirement paths from the main module to the
+//		given module, which is a module path or a path@version.
+//	-depth n
+//		Show only modules at most n requirements away from the main module.
+//	-picked
+//		Show only the versions picked by minimal version selection.
+//		Requirements on other versions are shown as requirements on the
+//		picked versions.
+//	-collapse prefixes
+//		Show modules whose paths start with one of the comma-separated path
+//		prefixes as a single node per prefix, named like "prefix/...".
+//	-exclude regexp
+//		Hide modules whose paths match the regular expression, along with
+//		the modules only they require. This is useful for hiding test-only
+//		or tool dependencies.
+//
 // See http://www.graphviz.org/doc/info/lang.html for details of the DOT language
 // and http://www.graphviz.org/about/ for Graphviz itself.
 //
@@ -33,19 +52,31 @@ import (
 	"io"
 	"log"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
 
 	"golang.org/x/mod/semver"
 )
 
+var (
+	focusFlag    = flag.String("focus", "", "show only requirement paths from the main module to `module` (path or path@version)")
+	depthFlag    = flag.Int("depth", 0, "show only modules at most `n` requirements from the main module (0 for no limit)")
+	pickedFlag   = flag.Bool("picked", false, "show only the versions picked by minimal version selection")
+	collapseFlag = flag.String("collapse", "", "show modules within each of the comma-separated path `prefixes` as one node")
+	excludeFlag  = flag.String("exclude", "", "hide modules whose paths match `regexp`, and the modules only they require")
+)
+
 func usage() {
-	fmt.Fprintf(os.Stderr, `Usage: go mod graph | modgraphviz | dot -Tpng -o graph.png
+	fmt.Fprintf(os.Stderr, `Usage: go mod graph | modgraphviz [flags] | dot -Tpng -o graph.png
 
 For each module, the node representing the greatest version (i.e., the
 version chosen by Go's minimal version selection algorithm) is colored green.
 Other nodes, which aren't in the final build list, are colored grey.
+
+Flags:
 `)
+	flag.PrintDefaults()
 	os.Exit(2)
 }
 
@@ -59,16 +90,41 @@ func main() {
 		usage()
 	}
 
-	if err := modgraphviz(os.Stdin, os.Stdout); err != nil {
+	f := &filter{
+		focus:  *focusFlag,
+		depth:  *depthFlag,
+		picked: *pickedFlag,
+	}
+	if f.depth < 0 {
+		log.Fatal("-depth must not be negative")
+	}
+	for _, prefix := range strings.Split(*collapseFlag, ",") {
+		if prefix = strings.TrimSuffix(strings.TrimSpace(prefix), "/"); prefix != "" {
+			f.collapse = append(f.collapse, prefix)
+		}
+	}
+	if *excludeFlag != "" {
+		re, err := regexp.Compile(*excludeFlag)
+		if err != nil {
+			log.Fatalf("-exclude: %v", err)
+		}
+		f.exclude = re
+	}
+
+	if err := modgraphviz(os.Stdin, os.Stdout, f); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func modgraphviz(in io.Reader, out io.Writer) error {
+func modgraphviz(in io.Reader, out io.Writer, f *filter) error {
 	graph, err := convert(in)
 	if err != nil {
 		return err
 	}
+	graph, err = f.apply(graph)
+	if err != nil {
+		return err
+	}
 
 	fmt.Fprintf(out, "digraph gomodgraph {\n")
 	fmt.Fprintf(out, "\tnode [ shape=rectangle fontsize=12 ]\n")
@@ -164,3 +220,252 @@ func (g *graph) edgesAsDOT() []byte {
 	}
 	return buf.Bytes()
 }
+
+// A filter selects the part of a module graph to show. The zero filter
+// selects the whole graph.
+type filter struct {
+	// focus, if not empty, is a module path or path@version. Only modules on
+	// requirement paths from the main module to a matching node are kept.
+	focus string
+
+	// depth, if positive, is the greatest number of requirements between the
+	// main module and a kept module.
+	depth int
+
+	// picked is true if only versions picked by MVS are kept. Requirements
+	// on other versions become requirements on the picked versions.
+	picked bool
+
+	// collapse lists module path prefixes. The modules within each prefix
+	// are merged into a single node named prefix+"/...".
+	collapse []string
+
+	// exclude, if not nil, matches the paths of modules to drop. Modules
+	// that are only required through dropped modules are dropped too.
+	exclude *regexp.Regexp
+}
+
+// apply returns the part of g selected by f.
+func (f *filter) apply(g *graph) (*graph, error) {
+	if f.focus == "" && f.depth == 0 && !f.picked && len(f.collapse) == 0 && f.exclude == nil {
+		return g, nil
+	}
+
+	roots := g.roots()
+	isRoot := map[string]bool{}
+	for _, n := range roots {
+		isRoot[n] = true
+	}
+	edges := g.edges
+	if f.exclude != nil {
+		excluded := func(n string) bool {
+			return !isRoot[n] && f.exclude.MatchString(modulePath(n))
+		}
+		edges = filterEdges(edges, func(n string) bool { return !excluded(n) })
+	}
+	if f.picked {
+		pickedNode := map[string]string{} // module path -> picked node
+		for _, n := range g.mvsPicked {
+			pickedNode[modulePath(n)] = n
+		}
+		unpicked := map[string]bool{}
+		for _, n := range g.mvsUnpicked {
+			unpicked[n] = true
+		}
+		var kept []edge
+		for _, e := range edges {
+			if unpicked[e.from] {
+				continue
+			}
+			if unpicked[e.to] {
+				e.to = pickedNode[modulePath(e.to)]
+			}
+			kept = append(kept, e)
+		}
+		edges = dedupEdges(kept)
+	}
+
+	// Keep the nodes that are still reachable from the roots, within
+	// f.depth requirements if set.
+	succs := map[string][]string{}
+	for _, e := range edges {
+		succs[e.from] = append(succs[e.from], e.to)
+	}
+	depth := map[string]int{}
+	queue := append([]string(nil), roots...)
+	for _, n := range roots {
+		depth[n] = 0
+	}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if f.depth > 0 && depth[n] == f.depth {
+			continue
+		}
+		for _, s := range succs[n] {
+			if _, ok := depth[s]; !ok {
+				depth[s] = depth[n] + 1
+				queue = append(queue, s)
+			}
+		}
+	}
+	keep := func(n string) bool {
+		_, ok := depth[n]
+		return ok
+	}
+	edges = filterEdges(edges, keep)
+
+	if f.focus != "" {
+		// Keep the nodes from which a focused node can be reached.
+		preds := map[string][]string{}
+		for _, e := range edges {
+			preds[e.to] = append(preds[e.to], e.from)
+		}
+		onPath := map[string]bool{}
+		queue = nil
+		for n := range depth {
+			if n == f.focus || modulePath(n) == f.focus {
+				onPath[n] = true
+				queue = append(queue, n)
+			}
+		}
+		if len(queue) == 0 {
+			return nil, fmt.Errorf("-focus: module %s is not in the graph", f.focus)
+		}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+			for _, p := range preds[n] {
+				if !onPath[p] {
+					onPath[p] = true
+					queue = append(queue, p)
+				}
+			}
+		}
+		keep = func(n string) bool { return onPath[n] }
+		edges = filterEdges(edges, keep)
+	}
+
+	fg := &graph{edges: edges}
+	for _, n := range g.mvsPicked {
+		if keep(n) {
+			fg.mvsPicked = append(fg.mvsPicked, n)
+		}
+	}
+	for _, n := range g.mvsUnpicked {
+		if keep(n) {
+			fg.mvsUnpicked = append(fg.mvsUnpicked, n)
+		}
+	}
+	if len(f.collapse) > 0 {
+		fg = fg.collapse(f.collapse)
+	}
+	return fg, nil
+}
+
+// roots returns the nodes for the main modules, which have no version. If
+// there are none, roots returns the nodes that no other node requires.
+func (g *graph) roots() []string {
+	var roots []string
+	seen := map[string]bool{}
+	required := map[string]bool{}
+	for _, e := range g.edges {
+		required[e.to] = true
+	}
+	for _, e := range g.edges {
+		for _, n := range []string{e.from, e.to} {
+			if !seen[n] && !strings.Contains(n, "@") {
+				seen[n] = true
+				roots = append(roots, n)
+			}
+		}
+	}
+	if len(roots) > 0 {
+		return roots
+	}
+	for _, e := range g.edges {
+		if !seen[e.from] && !required[e.from] {
+			seen[e.from] = true
+			roots = append(roots, e.from)
+		}
+	}
+	return roots
+}
+
+// collapse returns a graph in which the nodes for modules within each of the
+// path prefixes are merged into one node, named prefix+"/...". A module within
+// several prefixes is merged into the node for the longest one. A merged node
+// is picked if any of its modules is picked.
+func (g *graph) collapse(prefixes []string) *graph {
+	rename := func(n string) string {
+		m := modulePath(n)
+		best := ""
+		for _, p := range prefixes {
+			if (m == p || strings.HasPrefix(m, p+"/")) && len(p) > len(best) {
+				best = p
+			}
+		}
+		if best == "" {
+			return n
+		}
+		return best + "/..."
+	}
+
+	cg := &graph{}
+	for _, e := range g.edges {
+		e.from, e.to = rename(e.from), rename(e.to)
+		if e.from != e.to {
+			cg.edges = append(cg.edges, e)
+		}
+	}
+	cg.edges = dedupEdges(cg.edges)
+
+	picked := map[string]bool{}
+	for _, n := range g.mvsPicked {
+		if n = rename(n); !picked[n] {
+			picked[n] = true
+			cg.mvsPicked = append(cg.mvsPicked, n)
+		}
+	}
+	sort.Strings(cg.mvsPicked)
+	unpicked := map[string]bool{}
+	for _, n := range g.mvsUnpicked {
+		if n = rename(n); !picked[n] && !unpicked[n] {
+			unpicked[n] = true
+			cg.mvsUnpicked = append(cg.mvsUnpicked, n)
+		}
+	}
+	return cg
+}
+
+// filterEdges returns the edges between nodes for which keep returns true.
+func filterEdges(edges []edge, keep func(string) bool) []edge {
+	var kept []edge
+	for _, e := range edges {
+		if keep(e.from) && keep(e.to) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// dedupEdges removes repeated edges, keeping the first of each.
+func dedupEdges(edges []edge) []edge {
+	seen := map[edge]bool{}
+	var kept []edge
+	for _, e := range edges {
+		if !seen[e] {
+			seen[e] = true
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// modulePath returns the module path of a node, without its version.
+func modulePath(node string) string {
+	if i := strings.IndexByte(node, '@'); i >= 0 {
+		return node[:i]
+	}
+	return node
+}
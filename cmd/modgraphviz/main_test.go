@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -17,7 +19,7 @@ func TestRun(t *testing.T) {
 test.com/A@v1.0.0 test.com/B@v1.2.3
 test.com/B@v1.0.0 test.com/C@v4.5.6
 `))
-	if err := modgraphviz(in, out); err != nil {
+	if err := modgraphviz(in, out, &filter{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -114,3 +116,124 @@ func TestMVSPicking(t *testing.T) {
 		})
 	}
 }
+
+func TestFilter(t *testing.T) {
+	const in = `
+main example.com/a@v1.0.0
+main example.com/b@v1.1.0
+main example.com/tool@v1.0.0
+example.com/a@v1.0.0 example.com/b@v1.0.0
+example.com/a@v1.0.0 example.com/c@v1.0.0
+example.com/b@v1.0.0 example.com/d@v1.0.0
+example.com/b@v1.1.0 example.com/c@v1.1.0
+example.com/tool@v1.0.0 example.com/e@v1.0.0
+example.com/tool@v1.0.0 example.com/c@v1.0.0
+`
+	for _, tc := range []struct {
+		name         string
+		filter       filter
+		wantEdges    []string
+		wantPicked   []string
+		wantUnpicked []string
+		wantErr      string
+	}{
+		{
+			name:   "depth",
+			filter: filter{depth: 1},
+			wantEdges: []string{
+				"main -> example.com/a@v1.0.0",
+				"main -> example.com/b@v1.1.0",
+				"main -> example.com/tool@v1.0.0",
+			},
+			wantPicked: []string{"example.com/a@v1.0.0", "example.com/b@v1.1.0", "example.com/tool@v1.0.0"},
+		},
+		{
+			name:   "picked",
+			filter: filter{picked: true},
+			wantEdges: []string{
+				"main -> example.com/a@v1.0.0",
+				"main -> example.com/b@v1.1.0",
+				"main -> example.com/tool@v1.0.0",
+				"example.com/a@v1.0.0 -> example.com/b@v1.1.0",
+				"example.com/a@v1.0.0 -> example.com/c@v1.1.0",
+				"example.com/b@v1.1.0 -> example.com/c@v1.1.0",
+				"example.com/tool@v1.0.0 -> example.com/e@v1.0.0",
+				"example.com/tool@v1.0.0 -> example.com/c@v1.1.0",
+			},
+			wantPicked: []string{"example.com/a@v1.0.0", "example.com/b@v1.1.0", "example.com/c@v1.1.0", "example.com/e@v1.0.0", "example.com/tool@v1.0.0"},
+		},
+		{
+			name:   "focus path",
+			filter: filter{focus: "example.com/d"},
+			wantEdges: []string{
+				"main -> example.com/a@v1.0.0",
+				"example.com/a@v1.0.0 -> example.com/b@v1.0.0",
+				"example.com/b@v1.0.0 -> example.com/d@v1.0.0",
+			},
+			wantPicked:   []string{"example.com/a@v1.0.0", "example.com/d@v1.0.0"},
+			wantUnpicked: []string{"example.com/b@v1.0.0"},
+		},
+		{
+			name:   "focus version",
+			filter: filter{focus: "example.com/c@v1.1.0"},
+			wantEdges: []string{
+				"main -> example.com/b@v1.1.0",
+				"example.com/b@v1.1.0 -> example.com/c@v1.1.0",
+			},
+			wantPicked: []string{"example.com/b@v1.1.0", "example.com/c@v1.1.0"},
+		},
+		{
+			name:    "focus missing",
+			filter:  filter{focus: "example.com/d", depth: 2},
+			wantErr: "-focus: module example.com/d is not in the graph",
+		},
+		{
+			name:   "exclude",
+			filter: filter{exclude: regexp.MustCompile(`tool|/a$`)},
+			wantEdges: []string{
+				"main -> example.com/b@v1.1.0",
+				"example.com/b@v1.1.0 -> example.com/c@v1.1.0",
+			},
+			wantPicked: []string{"example.com/b@v1.1.0", "example.com/c@v1.1.0"},
+		},
+		{
+			name:   "collapse",
+			filter: filter{collapse: []string{"example.com"}, depth: 1},
+			wantEdges: []string{
+				"main -> example.com/...",
+			},
+			wantPicked: []string{"example.com/..."},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := convert(strings.NewReader(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err = tc.filter.apply(g)
+			if err != nil {
+				if err.Error() != tc.wantErr {
+					t.Fatalf("got error %q, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if tc.wantErr != "" {
+				t.Fatalf("got success, want error %q", tc.wantErr)
+			}
+
+			var gotEdges []string
+			for _, e := range g.edges {
+				gotEdges = append(gotEdges, e.from+" -> "+e.to)
+			}
+			if !reflect.DeepEqual(gotEdges, tc.wantEdges) {
+				t.Errorf("edges: got %q, want %q", gotEdges, tc.wantEdges)
+			}
+			if !reflect.DeepEqual(g.mvsPicked, tc.wantPicked) {
+				t.Errorf("picked: got %v, want %v", g.mvsPicked, tc.wantPicked)
+			}
+			if !reflect.DeepEqual(g.mvsUnpicked, tc.wantUnpicked) {
+				t.Errorf("unpicked: got %v, want %v", g.mvsUnpicked, tc.wantUnpicked)
+			}
+		})
+	}
+}